@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	unicodeenc "golang.org/x/text/encoding/unicode"
+)
+
+// Encoding names recorded for files with byte order marks,
+// encodingUTF8 names files without it in encoding changes.
+const (
+	encodingUTF8    = "utf-8"
+	encodingUTF8BOM = "utf-8 with BOM"
+	encodingUTF16LE = "utf-16le"
+	encodingUTF16BE = "utf-16be"
+)
+
+// namedEncoding is an encoding with its canonical name, e.g. "windows-1251".
+type namedEncoding struct {
+	Name     string
+	Encoding encoding.Encoding
+}
+
+// encodingRule assigns an encoding to non-UTF-8 files matching the pattern.
+type encodingRule struct {
+	Pattern  namePattern
+	Encoding namedEncoding
+}
+
+type encodingOptions struct {
+	Rules   []encodingRule  // first matching rule wins
+	Guesses []namedEncoding // candidates for non-UTF-8 files not matching any rule
+}
+
+func getEncoding(name string) (namedEncoding, error) {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return namedEncoding{}, fmt.Errorf("unknown encoding %q: %w", name, err)
+	}
+
+	canonical, err := htmlindex.Name(enc)
+	if err != nil {
+		canonical = strings.ToLower(name)
+	}
+
+	return namedEncoding{Name: canonical, Encoding: enc}, nil
+}
+
+// parseEncodingRules parses rules in "<pattern>:<encoding>" format,
+// e.g. "*.php:windows-1251" or "re:^legacy/:koi8-r".
+func parseEncodingRules(specs []string) ([]encodingRule, error) {
+	rules := make([]encodingRule, 0, len(specs))
+
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid encoding rule %q, expected <pattern>:<encoding>", spec)
+		}
+
+		patterns, err := parseNamePatterns([]string{spec[:i]})
+		if err != nil {
+			return nil, fmt.Errorf("parse pattern of %q: %w", spec, err)
+		}
+
+		enc, err := getEncoding(spec[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("parse encoding of %q: %w", spec, err)
+		}
+
+		rules = append(rules, encodingRule{Pattern: patterns[0], Encoding: enc})
+	}
+
+	return rules, nil
+}
+
+func parseEncodings(names []string) ([]namedEncoding, error) {
+	encodings := make([]namedEncoding, 0, len(names))
+	for _, name := range names {
+		enc, err := getEncoding(name)
+		if err != nil {
+			return nil, err
+		}
+		encodings = append(encodings, enc)
+	}
+	return encodings, nil
+}
+
+// hasUTF16BOM reports whether content starts with a UTF-16 byte order mark.
+func hasUTF16BOM(content []byte) bool {
+	return bytes.HasPrefix(content, []byte{0xFF, 0xFE}) || bytes.HasPrefix(content, []byte{0xFE, 0xFF})
+}
+
+// decode converts text content of the file to UTF-8 and returns the name
+// of the original encoding, empty for UTF-8 without BOM and binary files,
+// which are returned as is.
+// Byte order marks are detected first, then rules for non-UTF-8 files
+// are checked, then the most plausible of guessed encodings is picked.
+func (opts encodingOptions) decode(name string, content []byte) ([]byte, string, error) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		return content[3:], encodingUTF8BOM, nil
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		text, err := unicodeenc.UTF16(unicodeenc.LittleEndian, unicodeenc.ExpectBOM).NewDecoder().Bytes(content)
+		return text, encodingUTF16LE, err
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		text, err := unicodeenc.UTF16(unicodeenc.BigEndian, unicodeenc.ExpectBOM).NewDecoder().Bytes(content)
+		return text, encodingUTF16BE, err
+	}
+
+	if isBinary(content) || utf8.Valid(content) {
+		return content, "", nil
+	}
+
+	for _, rule := range opts.Rules {
+		if rule.Pattern.MatchPath(name) {
+			text, err := rule.Encoding.Encoding.NewDecoder().Bytes(content)
+			return text, rule.Encoding.Name, err
+		}
+	}
+
+	var (
+		best      []byte
+		bestName  string
+		bestScore int
+	)
+	for _, enc := range opts.Guesses {
+		text, err := enc.Encoding.NewDecoder().Bytes(content)
+		if err != nil {
+			continue
+		}
+		if score := textScore(text); best == nil || score > bestScore {
+			best, bestName, bestScore = text, enc.Name, score
+		}
+	}
+	if best == nil {
+		return content, "", nil
+	}
+
+	return best, bestName, nil
+}
+
+// isBinary reports whether content has a NUL byte in the first 8000 bytes, like git checks.
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) != -1
+}
+
+// textScore estimates how plausible decoded text is: words of non-ASCII letters
+// written in a consistent case score up, control characters, symbols
+// and words looking like mojibake score down.
+func textScore(text []byte) int {
+	score := 0
+
+	for _, word := range strings.FieldsFunc(string(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		var ascii, nonASCII, latin, caseChanges int
+		prev := rune(0)
+		for _, r := range word {
+			if r < utf8.RuneSelf {
+				ascii++
+			} else {
+				nonASCII++
+				if unicode.Is(unicode.Latin, r) {
+					latin++
+				}
+			}
+			// lower case letter followed by an upper case one, e.g. "пРИВЕТ"
+			if prev != 0 && unicode.IsLower(prev) && unicode.IsUpper(r) {
+				caseChanges++
+			}
+			prev = r
+		}
+
+		if nonASCII == 0 {
+			continue
+		}
+
+		switch {
+		case caseChanges > 0:
+			score -= caseChanges
+		case latin == nonASCII && ascii == 0 && nonASCII >= 2:
+			// accented Latin letters usually go along with plain ones
+			score--
+		default:
+			score++
+		}
+	}
+
+	for _, r := range string(text) {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r':
+			score -= 5
+		case r >= utf8.RuneSelf && (unicode.IsSymbol(r) || unicode.In(r, unicode.Co)):
+			score--
+		}
+	}
+
+	return score
+}
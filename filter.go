@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// namePattern matches names against a glob in path.Match syntax,
+// or against a regular expression if the pattern has "re:" prefix.
+type namePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func parseNamePatterns(patterns []string) ([]namePattern, error) {
+	result := make([]namePattern, 0, len(patterns))
+
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "re:") {
+			expr := strings.TrimPrefix(p, "re:")
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("parse regex %q: %w", expr, err)
+			}
+			result = append(result, namePattern{re: re})
+			continue
+		}
+
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("parse glob %q: %w", p, err)
+		}
+		result = append(result, namePattern{glob: p})
+	}
+
+	return result, nil
+}
+
+func (p namePattern) Match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+// MatchPath matches a file path, globs without slashes
+// are matched against the base name, like in .gitignore.
+func (p namePattern) MatchPath(name string) bool {
+	if p.re == nil && !strings.Contains(p.glob, "/") {
+		ok, _ := path.Match(p.glob, path.Base(name))
+		return ok
+	}
+	return p.Match(name)
+}
+
+func matchAny(patterns []namePattern, name string) bool {
+	for _, p := range patterns {
+		if p.Match(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// maxFuncnameLength is the length hunk header contexts are cut to, like git does.
+const maxFuncnameLength = 80
+
+// funcnamePatterns are built-in patterns of lines starting functions and classes
+// by file extension, like git funcname diff drivers. The first group is the context,
+// the whole line if there are no groups.
+var funcnamePatterns = map[string][]*regexp.Regexp{}
+
+func init() {
+	php := []string{
+		`^[\t ]*((?:(?:public|protected|private|static|abstract|final|readonly)[\t ]+)*function[\t ].*)$`,
+		`^[\t ]*((?:(?:final|abstract|readonly)[\t ]+)*(?:class|enum|interface|trait)[\t ]+.*)$`,
+	}
+	golang := []string{
+		`^(func[\t ].*)$`,
+		`^(type[\t ].*(?:struct|interface)[\t ]*\{?[\t ]*)$`,
+	}
+	js := []string{
+		`^[\t ]*((?:export[\t ]+)?(?:default[\t ]+)?(?:async[\t ]+)?function\b.*)$`,
+		`^[\t ]*((?:export[\t ]+)?(?:default[\t ]+)?(?:abstract[\t ]+)?class[\t ].*)$`,
+		`^[\t ]*((?:export[\t ]+)?(?:const|let|var)[\t ]+[$\w]+[\t ]*=[\t ]*(?:async[\t ]+)?(?:function\b|\([^)]*\)[\t ]*=>|[$\w]+[\t ]*=>).*)$`,
+		`^[\t ]+((?:(?:public|private|protected|static|async|get|set)[\t ]+)*[$\w]+[\t ]*\([^;]*\)[\t ]*\{[\t ]*)$`,
+	}
+	python := []string{
+		`^[\t ]*((?:class|(?:async[\t ]+)?def)[\t ].*)$`,
+	}
+	css := []string{
+		`^[\t ]*([^\s;{}/][^;{}]*?)[\t ]*\{`,
+	}
+
+	for exts, patterns := range map[string][]string{
+		".php":                                  php,
+		".go":                                   golang,
+		".js .mjs .cjs .jsx .ts .tsx .mts .cts": js,
+		".py":                                   python,
+		".css .scss .less":                      css,
+	} {
+		compiled := make([]*regexp.Regexp, len(patterns))
+		for i, p := range patterns {
+			compiled[i] = regexp.MustCompile(p)
+		}
+		for _, ext := range strings.Fields(exts) {
+			funcnamePatterns[ext] = compiled
+		}
+	}
+}
+
+// controlKeywords start lines looking like method definitions in JS, e.g. "if (a) {".
+var controlKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "else": true,
+	"return": true, "do": true, "try": true, "with": true,
+}
+
+// funcnameRule is a user-defined pattern of function lines of files matching Pattern.
+type funcnameRule struct {
+	Pattern namePattern
+	Regexp  *regexp.Regexp
+}
+
+// parseFuncnameRules parses rules in "<pattern>=<regex>" format, the first "=" separates
+// them, e.g. "*.tpl=^\{block name=(\w+)" or "re:^templates/=^<template (.*)>".
+func parseFuncnameRules(specs []string) ([]funcnameRule, error) {
+	rules := make([]funcnameRule, 0, len(specs))
+
+	for _, spec := range specs {
+		i := strings.Index(spec, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid funcname rule %q, expected <pattern>=<regex>", spec)
+		}
+
+		patterns, err := parseNamePatterns([]string{spec[:i]})
+		if err != nil {
+			return nil, fmt.Errorf("parse pattern of %q: %w", spec, err)
+		}
+
+		re, err := regexp.Compile(spec[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("parse regex of %q: %w", spec, err)
+		}
+
+		rules = append(rules, funcnameRule{Pattern: patterns[0], Regexp: re})
+	}
+
+	return rules, nil
+}
+
+// funcnameMatcher finds lines starting functions and classes.
+type funcnameMatcher []*regexp.Regexp
+
+// newFuncnameMatcher returns patterns of the first matching user rule,
+// or built-in ones for the file extension, nil if there are none.
+func newFuncnameMatcher(rules []funcnameRule, name string) funcnameMatcher {
+	for _, rule := range rules {
+		if rule.Pattern.MatchPath(name) {
+			return funcnameMatcher{rule.Regexp}
+		}
+	}
+	return funcnameMatcher(funcnamePatterns[strings.ToLower(path.Ext(name))])
+}
+
+// match returns the context of the line if it starts a function or a class, empty otherwise.
+func (m funcnameMatcher) match(line string) string {
+	line = strings.TrimRight(line, "\r\n")
+
+	for _, re := range m {
+		groups := re.FindStringSubmatch(line)
+		if groups == nil {
+			continue
+		}
+
+		context := groups[0]
+		if len(groups) > 1 {
+			context = groups[1]
+		}
+		context = strings.TrimRight(context, " \t")
+
+		words := strings.FieldsFunc(context, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == '('
+		})
+		if len(words) == 0 || controlKeywords[words[0]] {
+			continue
+		}
+
+		if r := []rune(context); len(r) > maxFuncnameLength {
+			context = string(r[:maxFuncnameLength])
+		}
+		return context
+	}
+
+	return ""
+}
+
+// enclosing returns the context of the nearest function line at or above every line,
+// empty for lines above the first function.
+func (m funcnameMatcher) enclosing(lines []string) []string {
+	result := make([]string, len(lines))
+	current := ""
+	for i, line := range lines {
+		if context := m.match(line); context != "" {
+			current = context
+		}
+		result[i] = current
+	}
+	return result
+}
+
+// setHunkFunctions sets Function of hunks to the nearest function line above them
+// in the old file, like git does, and appends it to hunk headers.
+func setHunkFunctions(hunks []hunk, patch diff.FilePatch, m funcnameMatcher) {
+	if len(m) == 0 {
+		return
+	}
+
+	oldContent, _ := patchContents(patch)
+	enclosing := m.enclosing(splitLinesKeepEOL(oldContent))
+
+	for i, h := range hunks {
+		// the line right above the hunk
+		if n := h.OldStart - 2; h.OldStart > 1 && n < len(enclosing) {
+			hunks[i].Function = enclosing[n]
+		}
+		if hunks[i].Function != "" {
+			hunks[i].Header += " " + hunks[i].Function
+		}
+	}
+}
+
+// functionsTouched returns contexts of functions and classes with changed lines,
+// deleted lines are looked up in the old file and added lines in the new one.
+func functionsTouched(patch diff.FilePatch, m funcnameMatcher) []string {
+	if len(m) == 0 || patch.IsBinary() {
+		return nil
+	}
+
+	oldContent, newContent := patchContents(patch)
+	oldEnclosing := m.enclosing(splitLinesKeepEOL(oldContent))
+	newEnclosing := m.enclosing(splitLinesKeepEOL(newContent))
+
+	var functions []string
+	seen := map[string]bool{}
+	add := func(context string) {
+		if context != "" && !seen[context] {
+			seen[context] = true
+			functions = append(functions, context)
+		}
+	}
+
+	oldNumber, newNumber := 0, 0
+	for _, chunk := range patch.Chunks() {
+		n := len(splitLinesKeepEOL(chunk.Content()))
+		switch chunk.Type() {
+		case diff.Equal:
+			oldNumber += n
+			newNumber += n
+		case diff.Delete:
+			for i := oldNumber; i < oldNumber+n && i < len(oldEnclosing); i++ {
+				add(oldEnclosing[i])
+			}
+			oldNumber += n
+		case diff.Add:
+			for i := newNumber; i < newNumber+n && i < len(newEnclosing); i++ {
+				add(newEnclosing[i])
+			}
+			newNumber += n
+		}
+	}
+
+	return functions
+}
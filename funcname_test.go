@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFuncnameMatch(t *testing.T) {
+	long := "func " + strings.Repeat("ы", 100) + "() {"
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"a.php", "    public static function boot(): void\n", "public static function boot(): void"},
+		{"a.php", "final class Kernel extends HttpKernel\n", "final class Kernel extends HttpKernel"},
+		{"a.php", "    $function = 1;\n", ""},
+		{"a.go", "func (g *generator) Run() error {\n", "func (g *generator) Run() error {"},
+		{"a.go", "type file struct {\r\n", "type file struct {"},
+		{"a.go", "\tfunc() {}()\n", ""},
+		{"a.go", long, "func " + strings.Repeat("ы", maxFuncnameLength-5)},
+		{"a.js", "export default async function load(url) {\n", "export default async function load(url) {"},
+		{"a.js", "const add = (a, b) => a + b;\n", "const add = (a, b) => a + b;"},
+		{"a.ts", "  async render(props) {\n", "async render(props) {"},
+		{"a.js", "  if (a) {\n", ""},
+		{"a.js", "  } else if (b) {\n", ""},
+		{"a.js", "  while (true) {\n", ""},
+		{"a.py", "    async def fetch(self):\n", "async def fetch(self):"},
+		{"a.py", "class Config(Base):\n", "class Config(Base):"},
+		{"a.py", "    default = 1\n", ""},
+		{"a.css", ".header a:hover {\n", ".header a:hover"},
+		{"a.scss", "@media (max-width: 600px) {\n", "@media (max-width: 600px)"},
+		{"a.css", "  color: red;\n", ""},
+		{"a.txt", "func main() {\n", ""},
+	}
+
+	for _, tt := range tests {
+		m := newFuncnameMatcher(nil, tt.name)
+		if got := m.match(tt.line); got != tt.want {
+			t.Errorf("match(%q) in %s = %q, want %q", tt.line, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFuncnameRules(t *testing.T) {
+	rules, err := parseFuncnameRules([]string{`*.tpl=^\{block name=(\w+)`, `*.go=^(func main)`})
+	if err != nil {
+		t.Fatalf("parseFuncnameRules() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"a.tpl", "{block name=content}\n", "content"},
+		{"a.go", "func main() {\n", "func main"},
+		// user rules replace built-in ones
+		{"a.go", "func run() {\n", ""},
+		{"a.php", "function run() {\n", "function run() {"},
+	}
+
+	for _, tt := range tests {
+		m := newFuncnameMatcher(rules, tt.name)
+		if got := m.match(tt.line); got != tt.want {
+			t.Errorf("match(%q) in %s = %q, want %q", tt.line, tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,53 +1,99 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 )
 
 type generator struct {
 	repo      *git.Repository
 	tmpl      *template.Template
 	copyFiles bool
+	manifests bool // write per-ref tree manifests for computing changes in the browser
+	noFiles   bool // skip rendering files lists
+	patches   bool // write unified diffs per pair and per file
+	htmlDiffs bool // render static diff pages per file
+	jsonDiffs bool // write JSON diffs per file
+
+	refOptions  refOptions
+	pairOptions pairOptions
+	diffOptions diffOptions
+	encodings   encodingOptions
+
+	objects storer.EncodedObjectStorer // repository objects and trees of pseudo-refs
+
+	rules map[plumbing.Hash]hiddenRules // hidden rules by tree hash, as every ref is in many pairs
 
 	contents map[string]map[string]string // tag -> file -> content
 }
 
 func (g *generator) Run() error {
-	log.Printf("Getting tags")
-	tags, err := getTags(g.repo)
+	g.objects = newOverlayStorer(g.repo.Storer)
+
+	log.Printf("Getting refs")
+	groups, err := getRefs(g.repo, g.objects, g.refOptions)
 	if err != nil {
-		return fmt.Errorf("get tags: %w", err)
+		return fmt.Errorf("get refs: %w", err)
 	}
 
+	var refs []ref
+	for _, group := range groups {
+		refs = append(refs, group.Refs...)
+	}
+
+	pairs, err := getPairs(groups, g.pairOptions)
+	if err != nil {
+		return fmt.Errorf("get pairs: %w", err)
+	}
+
+	pairs, bases, err := resolveMergeBases(g.repo, pairs, refs)
+	if err != nil {
+		return fmt.Errorf("resolve merge bases: %w", err)
+	}
+
+	// merge bases are not selectable, but their files are needed for three-dot pairs
+	contentRefs := append(refs[:len(refs):len(refs)], bases...)
+
 	// create output directory
 	if err := os.MkdirAll("output", 0755); err != nil {
 		return fmt.Errorf("create output directory: %w", err)
 	}
 
-	if err := g.renderIndex(tags); err != nil {
+	if err := g.renderIndex(groups, refs, pairs); err != nil {
 		return fmt.Errorf("render index: %w", err)
 	}
 
-	if err := g.renderFilesChanges(tags); err != nil {
-		return fmt.Errorf("render files: %w", err)
+	if !g.noFiles || g.patches || g.htmlDiffs || g.jsonDiffs {
+		if err := g.renderFilesChanges(pairs); err != nil {
+			return fmt.Errorf("render files: %w", err)
+		}
+	}
+
+	if g.manifests {
+		log.Printf("Writing manifests")
+		if err := g.writeManifests(contentRefs); err != nil {
+			return fmt.Errorf("write manifests: %w", err)
+		}
 	}
 
 	if g.copyFiles {
 		log.Printf("Pulling files")
-		if err := g.pullFiles(tags); err != nil {
+		if err := g.pullFiles(contentRefs); err != nil {
 			return fmt.Errorf("pull files: %w", err)
 		}
 	}
@@ -55,7 +101,7 @@ func (g *generator) Run() error {
 	return nil
 }
 
-func (g *generator) renderIndex(tags []tag) error {
+func (g *generator) renderIndex(groups []refGroup, refs []ref, pairs []pair) error {
 	// render index template into `output/index.html`
 	f, err := os.Create("output/index.html")
 	if err != nil {
@@ -63,10 +109,37 @@ func (g *generator) renderIndex(tags []tag) error {
 	}
 	defer f.Close()
 
+	var tags []ref
+	for _, r := range refs {
+		if r.Kind == kindTag {
+			tags = append(tags, r)
+		}
+	}
+
 	if err := g.tmpl.ExecuteTemplate(f, "index.gohtml", struct {
-		Tags []tag
+		Tags   []ref
+		Refs   []ref
+		Groups []refGroup
+		Pairs  map[string][]string // ref name -> names of refs it is compared to
+		Pages  []pair              // pairs of the first mode, linked without JavaScript
+
+		Modes      []string                     // comparison modes: two-dot, three-dot
+		MergeBases map[string]map[string]string // from -> to -> merge base name
+
+		Manifests  bool // true if changes between any refs can be computed from manifests
+		FilesPages bool // true if files lists were rendered for Pairs
 	}{
-		Tags: tags,
+		Tags:   tags,
+		Refs:   refs,
+		Groups: groups,
+		Pairs:  pairsMap(pairs),
+		Pages:  modePairs(pairs, g.pairOptions.Modes()[0]),
+
+		Modes:      g.pairOptions.Modes(),
+		MergeBases: mergeBasesMap(pairs),
+
+		Manifests:  g.manifests,
+		FilesPages: !g.noFiles,
 	}); err != nil {
 		return fmt.Errorf("execute template: %w", err)
 	}
@@ -74,55 +147,257 @@ func (g *generator) renderIndex(tags []tag) error {
 	return nil
 }
 
+type diffOptions struct {
+	Tree         object.DiffTreeOptions
+	Copies       bool // detect files copied from modified files
+	CopiesHarder bool // detect files copied from any file in the source tree
+
+	View       string // layout of static diff pages: side-by-side or unified
+	Whitespace string // whitespace changes to ignore: all, amount or eol, empty to compare as is
+	Intraline  string // granularity of changes within modified lines: word, char or none
+	MovedLines int    // minimum number of non-blank lines in moved blocks, 0 to skip detection
+
+	Limits limits
+
+	Structured bool // compare config files by keys, see structuredDiff
+
+	Funcname []funcnameRule // patterns of function lines, first matching rule wins over built-in ones
+
+	Hidden string              // what to do with generated, vendored and ignored files: collapse, exclude or show
+	Ignore []gitignore.Pattern // patterns of files to hide in addition to .diffignore of compared refs
+}
+
 type file struct {
-	Name      string
-	OldName   string
-	Operation string // A, D, M, R
+	Name       string
+	OldName    string // old name for renamed and deleted files, source name for copied files
+	Operation  string // A, D, M, R, C, T (type changed), X (only mode changed), S (submodule updated)
+	Similarity int    // similarity with the old file in percent, for renamed and copied files
+
+	WhitespaceOnly bool // only whitespace changed, set if whitespace is ignored
+	EncodingOnly   bool // only the encoding or the byte order mark changed, decoded contents are the same
+
+	// why the file is listed in the collapsed section: ignored, vendored, generated or no-diff,
+	// empty for other files
+	Hidden string
+
+	// why the diff is not shown: size, lines or files, see limits, empty otherwise
+	TooLarge string
+
+	// format config files were compared by keys in: json, yaml, ini or php,
+	// empty if they were not, and changed keys sorted by path
+	Structure  string
+	KeyChanges []keyChange
+
+	// functions and classes with changed lines, see funcnameMatcher
+	Functions []string
+
+	// original encodings of text files transcoded to UTF-8,
+	// empty for UTF-8 files without byte order mark
+	OldEncoding string
+	Encoding    string
+
+	Added   int // number of added lines
+	Removed int // number of removed lines
+
+	// blob hashes and sizes in bytes are set for binary and too large files only,
+	// the old ones are empty for added files and the new ones for deleted files
+	Binary  bool
+	OldHash string
+	OldSize int64
+	Hash    string
+	Size    int64
+
+	// modes like "100644" and types (file, symlink or submodule) of the old and the new entry,
+	// empty for missing ones
+	OldMode string
+	Mode    string
+	OldType string
+	Type    string
+
+	OldTarget string // targets of symlinks
+	Target    string
+	OldCommit string // commits of submodules
+	Commit    string
+
+	DiffPage string // URL of the static diff page relative to the output directory, empty if not rendered
+	DiffJSON string // path of the JSON diff relative to the output directory, empty if not written
+
+	// blocks of lines moved from and to other files, set if moves are detected
+	MovedFrom []movedBlock
+	MovedTo   []movedBlock
+
+	patch    diff.FilePatch // decoded to UTF-8, for line counts and rendered diffs
+	rawPatch diff.FilePatch // of blobs as they are in the repository, for written patches
+	change   *object.Change // to compute the raw patch of too large files when it is written
+}
+
+// path returns the new name of the file, or the old one for deleted files.
+func (f file) path() string {
+	if f.Operation == "D" {
+		return f.OldName
+	}
+	return f.Name
+}
+
+// diffStat is a summary of changes between two refs, like `git diff --stat` prints.
+type diffStat struct {
+	Files      int // number of changed files
+	Insertions int // number of added lines
+	Deletions  int // number of removed lines
+}
+
+func newDiffStat(changes []file) diffStat {
+	stat := diffStat{Files: len(changes)}
+	for _, f := range changes {
+		stat.Insertions += f.Added
+		stat.Deletions += f.Removed
+	}
+	return stat
+}
+
+// EncodingChange returns the original encoding of the file, e.g. "windows-1251",
+// or "windows-1251 → utf-8" if it changed, empty for UTF-8 files.
+func (f file) EncodingChange() string {
+	switch {
+	case f.OldEncoding == f.Encoding:
+		return f.Encoding
+	case f.Operation == "A":
+		return f.Encoding
+	case f.Operation == "D":
+		return f.OldEncoding
+	}
+
+	name := func(enc string) string {
+		if enc == "" {
+			return encodingUTF8
+		}
+		return enc
+	}
+	return name(f.OldEncoding) + " → " + name(f.Encoding)
 }
 
 func (f file) Less(other file) bool {
 	return f.Name < other.Name
 }
 
-func (g *generator) renderFilesChanges(tags []tag) error {
-	// get all combinations of tags
-	for _, tag1 := range tags {
-		for _, tag2 := range tags {
-			log.Printf("Rendering files changes between %s and %s", tag1.Name, tag2.Name)
-			if err := g.renderFilesChangesBetweenTags(tag1, tag2); err != nil {
-				return fmt.Errorf("render files for tags %s -> %s: %w", tag1.Name, tag2.Name, err)
-			}
-			if err := g.renderFilesChangesBetweenTags(tag2, tag1); err != nil {
-				return fmt.Errorf("render files for tags %s -> %s: %w", tag1.Name, tag2.Name, err)
-			}
+// filesPage is the data of files.gohtml.
+type filesPage struct {
+	Root    string // relative path to the output directory
+	Tag1    string // name of the ref changes are computed from, merge base for three-dot pairs
+	Tag2    string
+	From    string
+	To      string
+	Mode    string
+	Changes []file      // hidden files go last
+	Hidden  int         // number of generated, vendored and ignored files at the end of Changes
+	Tree    *changeTree // changes except hidden ones grouped by directories
+	Rows    []treeRow   // flattened Tree followed by hidden files
+	Stat    diffStat
+	Patch   string // URL of the pair patch relative to the output directory, empty if not written
+
+	Truncated truncation // files not diffed because of limits
+}
+
+// fileLink is the data of the "file" template of files.gohtml,
+// a link to the changed file labeled and styled by its operation.
+type fileLink struct {
+	*file
+	Root  string
+	Tag1  string
+	Tag2  string
+	Class string // operation class, e.g. "renamed" or "modified mode-changed"
+	Label string
+}
+
+// Link returns the data of the "file" template for f.
+func (p filesPage) Link(f *file, class, label string) fileLink {
+	return fileLink{file: f, Root: p.Root, Tag1: p.Tag1, Tag2: p.Tag2, Class: class, Label: label}
+}
+
+func (g *generator) renderFilesChanges(pairs []pair) error {
+	for _, p := range pairs {
+		log.Printf("Rendering files changes between %s and %s (%s)", p.From.Name, p.To.Name, p.Mode)
+		if err := g.renderFilesChangesBetweenTags(p); err != nil {
+			return fmt.Errorf("render files for %s -> %s: %w", p.From.Name, p.To.Name, err)
 		}
 	}
 	return nil
 }
 
-func (g *generator) renderFilesChangesBetweenTags(tag1, tag2 tag) error {
+func (g *generator) renderFilesChangesBetweenTags(p pair) error {
+	tag1, tag2 := p.Left(), p.To
+
 	changes, err := g.diff(tag1, tag2)
 	if err != nil {
 		return fmt.Errorf("collect changes: %w", err)
 	}
 
-	if err := os.MkdirAll(filepath.Join("output", "files", tag1.Name), 0755); err != nil {
-		return fmt.Errorf("create output/files/%s: %w", tag1.Name, err)
+	var patch string
+	if g.patches {
+		if err := g.writePatches(tag1, tag2, changes); err != nil {
+			return fmt.Errorf("write patches: %w", err)
+		}
+		patch = pathURL(patchPath(tag1.Name, tag2.Name))
 	}
 
-	f, err := os.Create(filepath.Join("output", "files", tag1.Name, tag2.Name+".html"))
+	if g.htmlDiffs || g.jsonDiffs {
+		if err := g.renderDiffPages(tag1, tag2, changes); err != nil {
+			return fmt.Errorf("render diff pages: %w", err)
+		}
+	}
+
+	if g.noFiles {
+		return nil
+	}
+
+	name := p.Page()
+	filePath := filepath.Join("output", filepath.FromSlash(name))
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(filePath), err)
+	}
+
+	f, err := os.Create(filePath)
 	if err != nil {
-		return fmt.Errorf("create output/files/%s/%s.html: %w", tag1.Name, tag2.Name, err)
+		return fmt.Errorf("create %s: %w", filePath, err)
 	}
+	defer f.Close()
 
-	if err := g.tmpl.ExecuteTemplate(f, "files.gohtml", struct {
-		Tag1    string
-		Tag2    string
-		Changes []file
-	}{
+	oldTree, err := g.tree(tag1)
+	if err != nil {
+		return fmt.Errorf("get tree for %s %q: %w", tag1.Kind, tag1.Name, err)
+	}
+	newTree, err := g.tree(tag2)
+	if err != nil {
+		return fmt.Errorf("get tree for %s %q: %w", tag2.Kind, tag2.Name, err)
+	}
+
+	var shown, hidden []file
+	for _, c := range changes {
+		if c.Hidden != "" {
+			hidden = append(hidden, c)
+		} else {
+			shown = append(shown, c)
+		}
+	}
+
+	tree := newChangeTree(shown, oldTree, newTree)
+
+	if err := g.tmpl.ExecuteTemplate(f, "files.gohtml", filesPage{
+		Root:    rootPath(name),
 		Tag1:    tag1.Name,
 		Tag2:    tag2.Name,
-		Changes: changes,
+		From:    p.From.Name,
+		To:      p.To.Name,
+		Mode:    p.Mode,
+		Changes: append(shown, hidden...),
+		Hidden:  len(hidden),
+		Tree:    tree,
+		Rows:    fileRows(tree, hidden),
+		Stat:    newDiffStat(changes),
+		Patch:   patch,
+
+		Truncated: newTruncation(changes, g.diffOptions.Limits),
 	}); err != nil {
 		return fmt.Errorf("execute template: %w", err)
 	}
@@ -130,26 +405,21 @@ func (g *generator) renderFilesChangesBetweenTags(tag1, tag2 tag) error {
 	return nil
 }
 
-func (g *generator) pullFiles(tags []tag) error {
+// contentPath returns the path of the copied file of the ref relative to the output directory.
+func contentPath(ref, name string) string {
+	return path.Join("content", refDir(ref), name)
+}
+
+func (g *generator) pullFiles(tags []ref) error {
 	// get all files in the tag
 	for _, tag := range tags {
-		commit, err := g.repo.CommitObject(tag.Hash)
-		if err != nil {
-			return fmt.Errorf("get commit for tag %q: %w", tag, err)
-		}
-
-		tree, err := commit.Tree()
+		tree, err := g.tree(tag)
 		if err != nil {
-			return fmt.Errorf("get tree: %w", err)
+			return fmt.Errorf("get tree for %s %q: %w", tag.Kind, tag.Name, err)
 		}
 
 		err = tree.Files().ForEach(func(file *object.File) error {
-			content, err := file.Contents()
-			if err != nil {
-				return fmt.Errorf("get file content: %w", err)
-			}
-
-			filePath := filepath.Join("output", "content", tag.Name, file.Name)
+			filePath := filepath.Join("output", filepath.FromSlash(contentPath(tag.Name, file.Name)))
 
 			if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
 				return fmt.Errorf("create dir: %w", err)
@@ -159,8 +429,36 @@ func (g *generator) pullFiles(tags []tag) error {
 			if err != nil {
 				return fmt.Errorf("create file: %w", err)
 			}
+			defer f.Close()
 
-			if _, err := f.WriteString(content); err != nil {
+			// too large files are copied as is to stay downloadable without being read into memory
+			if limit := g.diffOptions.Limits.MaxFileSize; limit > 0 && file.Size > limit {
+				log.Printf("%s in %s is too large (%s), copying without decoding", file.Name, tag.Name, formatSize(file.Size))
+
+				r, err := file.Reader()
+				if err != nil {
+					return fmt.Errorf("get file reader: %w", err)
+				}
+				defer r.Close()
+
+				if _, err := io.Copy(f, r); err != nil {
+					return fmt.Errorf("write file: %w", err)
+				}
+
+				return nil
+			}
+
+			content, err := file.Contents()
+			if err != nil {
+				return fmt.Errorf("get file content: %w", err)
+			}
+
+			decoded, _, err := g.encodings.decode(file.Name, []byte(content))
+			if err != nil {
+				return fmt.Errorf("decode %s: %w", file.Name, err)
+			}
+
+			if _, err := f.Write(decoded); err != nil {
 				return fmt.Errorf("write file: %w", err)
 			}
 
@@ -174,154 +472,383 @@ func (g *generator) pullFiles(tags []tag) error {
 	return nil
 }
 
-func (g *generator) diff(tag1, tag2 tag) ([]file, error) {
-	commit1, err := g.repo.CommitObject(tag1.Hash)
+// tree returns the root tree of the ref, including pseudo-refs for local changes.
+func (g *generator) tree(r ref) (*object.Tree, error) {
+	return object.GetTree(g.objects, r.Tree)
+}
+
+func (g *generator) diff(tag1, tag2 ref) ([]file, error) {
+	tree1, err := g.tree(tag1)
 	if err != nil {
-		return nil, fmt.Errorf("get commit for tag %q: %w", tag1.Name, err)
+		return nil, fmt.Errorf("get tree for %s %q: %w", tag1.Kind, tag1.Name, err)
 	}
 
-	commit2, err := g.repo.CommitObject(tag2.Hash)
+	tree2, err := g.tree(tag2)
 	if err != nil {
-		return nil, fmt.Errorf("get commit for tag %q: %w", tag2.Name, err)
+		return nil, fmt.Errorf("get tree for %s %q: %w", tag2.Kind, tag2.Name, err)
 	}
 
-	p, err := commit1.Patch(commit2)
+	treeChanges, err := object.DiffTreeWithOptions(context.Background(), tree1, tree2, &g.diffOptions.Tree)
 	if err != nil {
-		return nil, fmt.Errorf("get patch: %w", err)
+		return nil, fmt.Errorf("diff trees: %w", err)
 	}
 
-	patches := p.FilePatches()
-	changes := make([]file, 0, len(patches))
-	for _, patch := range patches {
-		if patch.IsBinary() {
-			continue
+	var copies map[*object.Change]copySource
+	if g.diffOptions.Copies || g.diffOptions.CopiesHarder {
+		copies, err = detectCopies(tree1, treeChanges, &g.diffOptions.Tree, g.diffOptions.CopiesHarder)
+		if err != nil {
+			return nil, fmt.Errorf("detect copies: %w", err)
 		}
+	}
 
-		from, to := patch.Files()
-
-		var toPath, fromPath string
-		if to != nil {
-			toPath = to.Path()
+	var oldRules, newRules hiddenRules
+	if g.diffOptions.Hidden != hiddenShow {
+		if oldRules, err = g.hiddenRules(tree1); err != nil {
+			return nil, fmt.Errorf("read attributes of %s %q: %w", tag1.Kind, tag1.Name, err)
 		}
-		if from != nil {
-			fromPath = from.Path()
+		if newRules, err = g.hiddenRules(tree2); err != nil {
+			return nil, fmt.Errorf("read attributes of %s %q: %w", tag2.Kind, tag2.Name, err)
 		}
+	}
 
-		if toPath == fromPath {
-			if !hasChanges(patch) {
+	changes := make([]file, 0, len(treeChanges))
+	for _, change := range treeChanges {
+		var hidden string
+		if g.diffOptions.Hidden != hiddenShow {
+			hidden = changeReason(change, oldRules, newRules)
+			if hidden != "" && g.diffOptions.Hidden == hiddenExclude {
 				continue
 			}
 		}
 
-		changes = append(changes, file{
-			Name:    toPath,
-			OldName: fromPath,
-			Operation: func(to, from string) string {
-				if from == "" {
-					return "A"
+		tooLarge, err := g.tooLarge(change, len(changes))
+		if err != nil {
+			return nil, fmt.Errorf("check size of %s: %w", change, err)
+		}
+
+		var patches []diff.FilePatch
+		if tooLarge != "" {
+			// contents are not compared, the patch has files only
+			from, to := changeFiles(change)
+			patches = []diff.FilePatch{textFilePatch{from: from, to: to}}
+		} else if isSubmoduleChange(change) {
+			patch, err := g.submodulePatch(change)
+			if err != nil {
+				return nil, fmt.Errorf("get patch for %s: %w", change, err)
+			}
+			patches = []diff.FilePatch{patch}
+		} else {
+			p, err := change.Patch()
+			if err != nil {
+				return nil, fmt.Errorf("get patch for %s: %w", change, err)
+			}
+			patches = p.FilePatches()
+		}
+
+		for _, patch := range patches {
+			from, to := patch.Files()
+
+			var toPath, fromPath string
+			if to != nil {
+				toPath = to.Path()
+			}
+			if from != nil {
+				fromPath = from.Path()
+			}
+
+			// binary patches have no chunks, their content changed if blobs differ
+			sameMode := change.From.TreeEntry.Mode == change.To.TreeEntry.Mode
+			if toPath == fromPath && sameMode && tooLarge == "" && !patch.IsBinary() && !hasChanges(patch) {
+				continue
+			}
+
+			// patches are written from raw blobs so that they apply to checkouts
+			rawPatch := patch
+
+			var oldEncoding, encoding string
+			if tooLarge == "" {
+				patch, oldEncoding, encoding, err = g.decodePatch(patch)
+				if err != nil {
+					return nil, fmt.Errorf("decode %s: %w", change, err)
 				}
+			}
 
-				if to == "" {
-					return "D"
+			// e.g. a byte order mark was added, raw blobs differ but decoded contents don't
+			encodingOnly := toPath == fromPath && oldEncoding != encoding && !patch.IsBinary() && !hasChanges(patch)
+
+			// keys are compared before whitespace is ignored, which changes old contents
+			var (
+				structure  string
+				keyChanges []keyChange
+			)
+			if g.diffOptions.Structured && tooLarge == "" && !patch.IsBinary() {
+				structure, keyChanges, err = structuredDiff(patch)
+				if err != nil && !errors.Is(err, errNotConfig) {
+					log.Printf("Can't compare keys of %s: %v", change, err)
 				}
+			}
 
-				if from != to {
-					return "R"
+			whitespaceOnly := false
+			if g.diffOptions.Whitespace != "" && tooLarge == "" && !patch.IsBinary() {
+				patch = ignoreWhitespace(patch, g.diffOptions.Whitespace)
+				whitespaceOnly = toPath == fromPath && !encodingOnly && !hasChanges(patch)
+				if !rawPatch.IsBinary() {
+					rawPatch = ignoreWhitespace(rawPatch, g.diffOptions.Whitespace)
 				}
+			}
 
-				return "M"
-			}(toPath, fromPath),
-		})
+			f := file{
+				Name:           toPath,
+				OldName:        fromPath,
+				OldEncoding:    oldEncoding,
+				Encoding:       encoding,
+				WhitespaceOnly: whitespaceOnly,
+				EncodingOnly:   encodingOnly,
+				Hidden:         hidden,
+				TooLarge:       tooLarge,
+				Structure:      structure,
+				KeyChanges:     keyChanges,
+				patch:          patch,
+				rawPatch:       rawPatch,
+				change:         change,
+				Operation: func(to, from string) string {
+					if from == "" {
+						return "A"
+					}
+
+					if to == "" {
+						return "D"
+					}
+
+					if from != to {
+						return "R"
+					}
+
+					return "M"
+				}(toPath, fromPath),
+			}
+
+			if err := g.setModes(&f, change); err != nil {
+				return nil, fmt.Errorf("get modes for %s: %w", change, err)
+			}
+
+			f.Added, f.Removed = countLines(patch)
+
+			// the patch of too many lines is dropped, only its line counts are kept
+			if limit := g.diffOptions.Limits.MaxDiffLines; limit > 0 && f.Added+f.Removed > limit {
+				f.TooLarge = tooLargeLines
+				f.patch = textFilePatch{from: from, to: to}
+				f.rawPatch = nil
+			}
+
+			if !patch.IsBinary() && f.TooLarge == "" {
+				f.Functions = functionsTouched(f.patch, newFuncnameMatcher(g.diffOptions.Funcname, f.path()))
+			}
+
+			switch {
+			case patch.IsBinary():
+				if err := g.setBinary(&f, from, to); err != nil {
+					return nil, fmt.Errorf("get sizes for %s: %w", change, err)
+				}
+			case f.TooLarge != "":
+				if err := g.setSizes(&f, from, to); err != nil {
+					return nil, fmt.Errorf("get sizes for %s: %w", change, err)
+				}
+			}
+
+			if src, ok := copies[change]; ok {
+				f.Operation = "C"
+				f.OldName = src.Name
+				f.Similarity = src.Similarity
+			}
+
+			if f.Operation == "R" && tooLarge == "" {
+				fromFile, toFile, err := change.Files()
+				if err != nil {
+					return nil, fmt.Errorf("get files for %s: %w", change, err)
+				}
+				f.Similarity, err = fileSimilarity(fromFile, toFile)
+				if err != nil {
+					return nil, fmt.Errorf("get similarity for %s: %w", change, err)
+				}
+			}
+
+			changes = append(changes, f)
+		}
+	}
+
+	if g.diffOptions.MovedLines > 0 {
+		detectMoves(changes, g.diffOptions.MovedLines)
 	}
 
 	return changes, nil
 }
 
-func hasChanges(patch diff.FilePatch) bool {
-	for _, chunk := range patch.Chunks() {
-		if chunk.Type() != diff.Equal {
-			return true
+// decodePatch transcodes contents of the file patch to UTF-8 and recomputes it
+// if any of the files is not in UTF-8. Binary patches are checked for UTF-16 files.
+func (g *generator) decodePatch(patch diff.FilePatch) (diff.FilePatch, string, string, error) {
+	from, to := patch.Files()
+
+	var oldContent, newContent []byte
+	if !patch.IsBinary() {
+		o, n := patchContents(patch)
+		oldContent, newContent = []byte(o), []byte(n)
+	} else {
+		utf16 := false
+		for _, f := range []diff.File{from, to} {
+			if f == nil {
+				continue
+			}
+			bom, err := g.readBlob(f.Hash(), 2)
+			if err != nil {
+				return nil, "", "", err
+			}
+			utf16 = utf16 || hasUTF16BOM(bom)
+		}
+		if !utf16 {
+			return patch, "", "", nil
+		}
+
+		var err error
+		if from != nil {
+			if oldContent, err = g.readBlob(from.Hash(), -1); err != nil {
+				return nil, "", "", err
+			}
+		}
+		if to != nil {
+			if newContent, err = g.readBlob(to.Hash(), -1); err != nil {
+				return nil, "", "", err
+			}
 		}
 	}
-	return false
+
+	var oldEncoding, newEncoding string
+	var err error
+	if from != nil {
+		oldContent, oldEncoding, err = g.encodings.decode(from.Path(), oldContent)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("decode %s: %w", from.Path(), err)
+		}
+	}
+	if to != nil {
+		newContent, newEncoding, err = g.encodings.decode(to.Path(), newContent)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("decode %s: %w", to.Path(), err)
+		}
+	}
+
+	if oldEncoding == "" && newEncoding == "" {
+		return patch, "", "", nil
+	}
+	if isBinary(oldContent) || isBinary(newContent) {
+		// UTF-16 file replaced with a binary one
+		return patch, "", "", nil
+	}
+
+	return lineDiff(from, to, string(oldContent), string(newContent), ""), oldEncoding, newEncoding, nil
 }
 
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
+// readBlob reads up to n bytes of the blob, or all of it if n is negative.
+func (g *generator) readBlob(hash plumbing.Hash, n int64) ([]byte, error) {
+	blob, err := object.GetBlob(g.objects, hash)
 	if err != nil {
-		return fmt.Errorf("open file: %w", err)
+		return nil, fmt.Errorf("get blob %s: %w", hash, err)
 	}
-	defer in.Close()
 
-	out, err := os.Create(dst)
+	r, err := blob.Reader()
 	if err != nil {
-		return fmt.Errorf("create file: %w", err)
+		return nil, fmt.Errorf("read blob %s: %w", hash, err)
 	}
-	defer out.Close()
+	defer r.Close()
 
-	if _, err := io.Copy(out, in); err != nil {
-		return fmt.Errorf("copy: %w", err)
+	if n >= 0 {
+		return io.ReadAll(io.LimitReader(r, n))
 	}
-
-	return nil
+	return io.ReadAll(r)
 }
 
-type tag struct {
-	Name    string
-	Hash    plumbing.Hash
-	version int
+// setBinary marks f as binary and sets sizes and hashes of its blobs.
+func (g *generator) setBinary(f *file, from, to diff.File) error {
+	f.Binary = true
+	return g.setSizes(f, from, to)
 }
 
-func (t tag) Version() int {
-	if t.version != 0 {
-		return t.version
+// setSizes sets sizes and hashes of blobs of f.
+func (g *generator) setSizes(f *file, from, to diff.File) error {
+	if from != nil && !isSubmoduleFile(from) {
+		size, err := g.objects.EncodedObjectSize(from.Hash())
+		if err != nil {
+			return fmt.Errorf("get size of %s: %w", from.Hash(), err)
+		}
+		f.OldHash, f.OldSize = from.Hash().String(), size
 	}
 
-	// tag has a format "2.10-v3877"
-	// we want to return "3877" part
-	parts := strings.Split(t.Name, "v")
-	if len(parts) != 2 {
-		log.Printf("tag %q has unexpected format", t.Name)
-		return 0
+	if to != nil && !isSubmoduleFile(to) {
+		size, err := g.objects.EncodedObjectSize(to.Hash())
+		if err != nil {
+			return fmt.Errorf("get size of %s: %w", to.Hash(), err)
+		}
+		f.Hash, f.Size = to.Hash().String(), size
 	}
 
-	v, err := strconv.Atoi(parts[1])
-	if err != nil {
-		log.Printf("tag %q has unexpected format: %v", t.Name, err)
-		return 0
+	return nil
+}
+
+// countLines returns numbers of added and removed lines in the patch.
+func countLines(patch diff.FilePatch) (added, removed int) {
+	for _, chunk := range patch.Chunks() {
+		switch chunk.Type() {
+		case diff.Add:
+			added += lineCount(chunk.Content())
+		case diff.Delete:
+			removed += lineCount(chunk.Content())
+		}
 	}
+	return added, removed
+}
 
-	t.version = v
-	return v
+// lineCount returns number of lines in s, the last line may have no newline.
+func lineCount(s string) int {
+	n := strings.Count(s, "\n")
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		n++
+	}
+	return n
 }
 
-func getTags(r *git.Repository) ([]tag, error) {
-	var tags []tag
+func hasChanges(patch diff.FilePatch) bool {
+	for _, chunk := range patch.Chunks() {
+		if chunk.Type() != diff.Equal {
+			return true
+		}
+	}
+	return false
+}
 
-	refs, err := r.Tags()
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
 	if err != nil {
-		return nil, fmt.Errorf("get tags: %w", err)
+		return fmt.Errorf("open file: %w", err)
 	}
+	defer in.Close()
 
-	err = refs.ForEach(func(ref *plumbing.Reference) error {
-		t := strings.TrimLeft(ref.Name().String(), "refs/tags/")
-		tags = append(tags, tag{
-			Name: t,
-			Hash: ref.Hash(),
-		})
-		return nil
-	})
+	out, err := os.Create(dst)
 	if err != nil {
-		return nil, fmt.Errorf("iterate tags: %w", err)
+		return fmt.Errorf("create file: %w", err)
 	}
+	defer out.Close()
 
-	sort.Slice(tags, func(i, j int) bool {
-		// tag has a format "2.10-v3877"
-		// we want to sort by "v3877" part descending
-		return tags[i].Version() > tags[j].Version()
-	})
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+
+	return nil
+}
 
-	return tags, nil
+// rootPath returns relative path from the directory of
+// the output file name to the output directory.
+func rootPath(name string) string {
+	return strings.Repeat("../", strings.Count(name, "/"))
 }
 
 type patch struct {
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Modes of handling hidden files, see diffOptions.Hidden.
+const (
+	hiddenCollapse = "collapse" // list them in a separate collapsed section
+	hiddenExclude  = "exclude"  // skip them entirely
+	hiddenShow     = "show"     // list them as other files
+)
+
+// Reasons to hide files, see file.Hidden.
+const (
+	hiddenIgnored   = "ignored"   // matches .diffignore or --ignore-file patterns
+	hiddenVendored  = "vendored"  // has linguist-vendored attribute
+	hiddenGenerated = "generated" // has linguist-generated attribute
+	hiddenNoDiff    = "no-diff"   // has -diff or binary attribute
+)
+
+// diffIgnoreFile is a file in the root of the tree with patterns of files to hide,
+// in .gitignore format.
+const diffIgnoreFile = ".diffignore"
+
+// hiddenRules are .gitattributes and ignore patterns of a tree.
+type hiddenRules struct {
+	attributes []gitattributes.MatchAttribute // in order of increasing priority
+	ignore     gitignore.Matcher
+}
+
+// readIgnorePatterns parses patterns in .gitignore format.
+func readIgnorePatterns(r io.Reader) ([]gitignore.Pattern, error) {
+	var patterns []gitignore.Pattern
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+
+	return patterns, scanner.Err()
+}
+
+// readIgnoreFile reads patterns from the file on disk, empty name means no patterns.
+func readIgnoreFile(name string) ([]gitignore.Pattern, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	patterns, err := readIgnorePatterns(f)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+
+	return patterns, nil
+}
+
+// hiddenRules returns hidden rules of the tree, read once per tree.
+func (g *generator) hiddenRules(tree *object.Tree) (hiddenRules, error) {
+	if rules, ok := g.rules[tree.Hash]; ok {
+		return rules, nil
+	}
+
+	rules, err := readHiddenRules(tree, g.diffOptions.Ignore)
+	if err != nil {
+		return rules, err
+	}
+
+	if g.rules == nil {
+		g.rules = map[plumbing.Hash]hiddenRules{}
+	}
+	g.rules[tree.Hash] = rules
+	return rules, nil
+}
+
+// readHiddenRules reads all .gitattributes files and .diffignore of the tree,
+// extra ignore patterns take precedence over .diffignore.
+func readHiddenRules(tree *object.Tree, extra []gitignore.Pattern) (hiddenRules, error) {
+	var rules hiddenRules
+
+	// .gitattributes deeper in the tree take precedence
+	var names []string
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rules, fmt.Errorf("walk tree: %w", err)
+		}
+		if path.Base(name) == ".gitattributes" && entry.Mode.IsFile() {
+			names = append(names, name)
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return strings.Count(names[i], "/") < strings.Count(names[j], "/")
+	})
+
+	for _, name := range names {
+		content, err := treeFileContent(tree, name)
+		if err != nil {
+			return rules, err
+		}
+
+		var domain []string
+		if dir := path.Dir(name); dir != "." {
+			domain = strings.Split(dir, "/")
+		}
+
+		for _, line := range strings.Split(string(content), "\n") {
+			// patterns of directories don't apply to files inside them
+			if fields := strings.Fields(line); len(fields) == 0 || strings.HasSuffix(fields[0], "/") {
+				continue
+			}
+
+			attr, err := gitattributes.ParseAttributesLine(line, domain, domain == nil)
+			if err != nil || attr.Pattern == nil {
+				continue // macros and invalid lines are skipped like git does
+			}
+			rules.attributes = append(rules.attributes, attr)
+		}
+	}
+
+	var patterns []gitignore.Pattern
+	if _, err := tree.File(diffIgnoreFile); err == nil {
+		content, err := treeFileContent(tree, diffIgnoreFile)
+		if err != nil {
+			return rules, err
+		}
+		if patterns, err = readIgnorePatterns(bytes.NewReader(content)); err != nil {
+			return rules, fmt.Errorf("read %s: %w", diffIgnoreFile, err)
+		}
+	}
+	rules.ignore = gitignore.NewMatcher(append(patterns, extra...))
+
+	return rules, nil
+}
+
+func treeFileContent(tree *object.Tree, name string) ([]byte, error) {
+	f, err := tree.File(name)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", name, err)
+	}
+
+	content, err := f.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+
+	return []byte(content), nil
+}
+
+// changeReason returns why the changed file should be hidden according
+// to rules of the old or the new tree, empty if it should not.
+func changeReason(change *object.Change, oldRules, newRules hiddenRules) string {
+	if change.To.Name != "" {
+		if reason := newRules.reason(change.To.Name); reason != "" {
+			return reason
+		}
+	}
+	if change.From.Name != "" {
+		return oldRules.reason(change.From.Name)
+	}
+	return ""
+}
+
+// reason returns why the file should be hidden, empty if it should not.
+func (r hiddenRules) reason(name string) string {
+	parts := strings.Split(name, "/")
+
+	if r.ignore != nil && r.ignore.Match(parts, false) {
+		return hiddenIgnored
+	}
+
+	var noDiff, generated, vendored bool
+	for _, m := range r.attributes {
+		if !m.Pattern.Match(parts) {
+			continue
+		}
+
+		for _, attr := range m.Attributes {
+			switch attr.Name() {
+			case "binary":
+				if attr.IsSet() {
+					noDiff = true
+				}
+			case "diff":
+				noDiff = attr.IsUnset()
+			case "linguist-generated":
+				generated = isTrue(attr)
+			case "linguist-vendored":
+				vendored = isTrue(attr)
+			}
+		}
+	}
+
+	switch {
+	case vendored:
+		return hiddenVendored
+	case generated:
+		return hiddenGenerated
+	case noDiff:
+		return hiddenNoDiff
+	}
+
+	return ""
+}
+
+func isTrue(attr gitattributes.Attribute) bool {
+	return attr.IsSet() || attr.IsValueSet() && attr.Value() == "true"
+}
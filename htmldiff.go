@@ -0,0 +1,440 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// diffLine is a line of a hunk, line numbers are 0 for lines
+// missing on one of the sides.
+type diffLine struct {
+	Kind      string        `json:"kind"` // context, add or delete
+	OldNumber int           `json:"old,omitempty"`
+	NewNumber int           `json:"new,omitempty"`
+	Text      string        `json:"text"`
+	Changes   []span        `json:"changes,omitempty"` // changed parts of modified lines, see addIntraline
+	Moved     bool          `json:"moved,omitempty"`   // line is a part of a block moved to or from another place
+	HTML      template.HTML `json:"-"`                 // highlighted content with changed parts marked
+}
+
+// diffRow is a row of a side-by-side diff, one of the sides is nil
+// for lines added or deleted without a counterpart.
+type diffRow struct {
+	Left  *diffLine
+	Right *diffLine
+}
+
+type hunk struct {
+	Header   string     `json:"header"`             // e.g. "@@ -1,4 +1,5 @@ func main() {"
+	Function string     `json:"function,omitempty"` // nearest function or class line above the hunk
+	OldStart int        `json:"oldStart"`
+	OldLines int        `json:"oldLines"`
+	NewStart int        `json:"newStart"`
+	NewLines int        `json:"newLines"`
+	Lines    []diffLine `json:"lines"`
+}
+
+// Rows returns hunk lines paired for a side-by-side view,
+// deleted lines are paired with lines added right after them.
+func (h hunk) Rows() []diffRow {
+	var rows []diffRow
+
+	for i := 0; i < len(h.Lines); {
+		if h.Lines[i].Kind == "context" {
+			rows = append(rows, diffRow{Left: &h.Lines[i], Right: &h.Lines[i]})
+			i++
+			continue
+		}
+
+		var deleted, added []*diffLine
+		for ; i < len(h.Lines) && h.Lines[i].Kind == "delete"; i++ {
+			deleted = append(deleted, &h.Lines[i])
+		}
+		for ; i < len(h.Lines) && h.Lines[i].Kind == "add"; i++ {
+			added = append(added, &h.Lines[i])
+		}
+
+		for j := 0; j < len(deleted) || j < len(added); j++ {
+			var row diffRow
+			if j < len(deleted) {
+				row.Left = deleted[j]
+			}
+			if j < len(added) {
+				row.Right = added[j]
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	return rows
+}
+
+// diffPagePath returns the path of the file diff page relative to the output directory.
+func diffPagePath(from, to, name string) string {
+	return path.Join("diffs", refDir(from), refDir(to), name+".html")
+}
+
+// renderDiffPages renders a static diff page per each changed file
+// into `diffs/<from>/<to>/<file>.html` and sets DiffPage of changes,
+// and writes JSON diffs next to them if enabled.
+func (g *generator) renderDiffPages(from, to ref, changes []file) error {
+	if g.htmlDiffs {
+		linkMovedBlocks(from, to, changes)
+	}
+
+	for i, f := range changes {
+		name := f.path()
+
+		var hunks []hunk
+		if !f.Binary && f.TooLarge == "" {
+			hunks = buildHunks(f.patch, diff.DefaultContextLines, g.diffOptions.Intraline)
+			setHunkFunctions(hunks, f.patch, newFuncnameMatcher(g.diffOptions.Funcname, name))
+			markMoved(hunks, f)
+		}
+
+		if g.htmlDiffs {
+			page := diffPagePath(from.Name, to.Name, name)
+			if err := g.renderDiffPage(page, from, to, f, hunks); err != nil {
+				return fmt.Errorf("render diff for %s: %w", name, err)
+			}
+			changes[i].DiffPage = pathURL(page)
+		}
+
+		if g.jsonDiffs {
+			p := diffJSONPath(from.Name, to.Name, name)
+			if err := writeDiffJSON(p, from, to, f, hunks); err != nil {
+				return fmt.Errorf("write JSON diff for %s: %w", name, err)
+			}
+			changes[i].DiffJSON = p
+		}
+	}
+
+	return nil
+}
+
+// linkMovedBlocks sets DiffPage of moved blocks to pages of the other files.
+func linkMovedBlocks(from, to ref, changes []file) {
+	for _, f := range changes {
+		for i, b := range f.MovedFrom {
+			f.MovedFrom[i].DiffPage = pathURL(diffPagePath(from.Name, to.Name, b.Name))
+		}
+		for i, b := range f.MovedTo {
+			f.MovedTo[i].DiffPage = pathURL(diffPagePath(from.Name, to.Name, b.Name))
+		}
+	}
+}
+
+// markMoved sets Moved of added lines moved from other places
+// and of deleted lines moved to other places, intraline changes
+// are cleared for them.
+func markMoved(hunks []hunk, f file) {
+	if len(f.MovedFrom) == 0 && len(f.MovedTo) == 0 {
+		return
+	}
+
+	added, deleted := map[int]bool{}, map[int]bool{}
+	for _, b := range f.MovedFrom {
+		for n := b.NewStart; n <= b.NewEnd(); n++ {
+			added[n] = true
+		}
+	}
+	for _, b := range f.MovedTo {
+		for n := b.OldStart; n <= b.OldEnd(); n++ {
+			deleted[n] = true
+		}
+	}
+
+	for _, h := range hunks {
+		for i, l := range h.Lines {
+			switch {
+			case l.Kind == "add" && added[l.NewNumber],
+				l.Kind == "delete" && deleted[l.OldNumber]:
+				h.Lines[i].Moved = true
+				h.Lines[i].Changes = nil
+			}
+		}
+	}
+}
+
+func (g *generator) renderDiffPage(page string, from, to ref, f file, hunks []hunk) error {
+	filePath := filepath.Join("output", filepath.FromSlash(page))
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(filePath), err)
+	}
+
+	out, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", filePath, err)
+	}
+	defer out.Close()
+
+	if len(hunks) > 0 {
+		highlightHunks(f.patch, hunks)
+	}
+
+	if err := g.tmpl.ExecuteTemplate(out, "diff.gohtml", struct {
+		Root  string
+		Tag1  string
+		Tag2  string
+		File  file
+		View  string
+		Hunks []hunk
+
+		Content    bool   // whether files are copied to content/<ref>/
+		OldContent string // URLs of copied files relative to the output directory
+		NewContent string
+		Limits     limits // why TooLarge files are not diffed
+	}{
+		Root:  rootPath(page),
+		Tag1:  from.Name,
+		Tag2:  to.Name,
+		File:  f,
+		View:  g.diffOptions.View,
+		Hunks: hunks,
+
+		Content:    g.copyFiles,
+		OldContent: pathURL(contentPath(from.Name, f.OldName)),
+		NewContent: pathURL(contentPath(to.Name, f.Name)),
+		Limits:     g.diffOptions.Limits,
+	}); err != nil {
+		return fmt.Errorf("execute template: %w", err)
+	}
+
+	return nil
+}
+
+// buildHunks splits the file patch into hunks with the given number
+// of context lines around changes, like `git diff` does.
+// Changed parts of modified lines are found with the intraline granularity.
+func buildHunks(patch diff.FilePatch, contextLines int, intraline string) []hunk {
+	var lines []diffLine
+	oldNumber, newNumber := 0, 0
+
+	for _, chunk := range patch.Chunks() {
+		for _, text := range splitLines(chunk.Content()) {
+			l := diffLine{Text: text}
+			switch chunk.Type() {
+			case diff.Equal:
+				oldNumber++
+				newNumber++
+				l.Kind, l.OldNumber, l.NewNumber = "context", oldNumber, newNumber
+			case diff.Delete:
+				oldNumber++
+				l.Kind, l.OldNumber = "delete", oldNumber
+			case diff.Add:
+				newNumber++
+				l.Kind, l.NewNumber = "add", newNumber
+			}
+			lines = append(lines, l)
+		}
+	}
+
+	addIntraline(lines, intraline)
+
+	var hunks []hunk
+	for start := 0; start < len(lines); {
+		// find the next change and extend the hunk while changes are close enough
+		first := start
+		for first < len(lines) && lines[first].Kind == "context" {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+
+		last := first
+		for i := first; i < len(lines) && i <= last+2*contextLines+1; i++ {
+			if lines[i].Kind != "context" {
+				last = i
+			}
+		}
+
+		begin := first - contextLines
+		if begin < start {
+			begin = start
+		}
+		end := last + contextLines + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		hunks = append(hunks, newHunk(lines[begin:end]))
+		start = end
+	}
+
+	return hunks
+}
+
+func newHunk(lines []diffLine) hunk {
+	var oldStart, oldLines, newStart, newLines int
+	for _, l := range lines {
+		if l.OldNumber > 0 {
+			if oldStart == 0 {
+				oldStart = l.OldNumber
+			}
+			oldLines++
+		}
+		if l.NewNumber > 0 {
+			if newStart == 0 {
+				newStart = l.NewNumber
+			}
+			newLines++
+		}
+	}
+
+	return hunk{
+		Header:   fmt.Sprintf("@@ -%s +%s @@", hunkRange(oldStart, oldLines), hunkRange(newStart, newLines)),
+		OldStart: oldStart,
+		OldLines: oldLines,
+		NewStart: newStart,
+		NewLines: newLines,
+		Lines:    lines,
+	}
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// splitLines splits s into lines without line endings.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// highlightHunks sets HTML of hunk lines highlighting full contents of the patch files.
+func highlightHunks(patch diff.FilePatch, hunks []hunk) {
+	from, to := patch.Files()
+
+	var oldName, newName string
+	if from != nil {
+		oldName = from.Path()
+	}
+	if to != nil {
+		newName = to.Path()
+	}
+
+	oldContent, newContent := patchContents(patch)
+	oldTokens := highlightLines(oldName, oldContent)
+	newTokens := highlightLines(newName, newContent)
+
+	for _, h := range hunks {
+		for i, l := range h.Lines {
+			if l.NewNumber > 0 {
+				h.Lines[i].HTML = renderLine(lineTokens(newTokens, l.NewNumber-1), l.Changes)
+			} else {
+				h.Lines[i].HTML = renderLine(lineTokens(oldTokens, l.OldNumber-1), l.Changes)
+			}
+		}
+	}
+}
+
+// highlightLines splits content into lines of tokens,
+// the lexer is picked by the file name.
+func highlightLines(name, content string) [][]chroma.Token {
+	lexer := lexers.Match(path.Base(name))
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	it, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		// render without highlighting
+		lines := splitLines(content)
+		result := make([][]chroma.Token, len(lines))
+		for i, line := range lines {
+			result[i] = []chroma.Token{{Type: chroma.Text, Value: line}}
+		}
+		return result
+	}
+
+	return chroma.SplitTokensIntoLines(it.Tokens())
+}
+
+func lineTokens(lines [][]chroma.Token, i int) []chroma.Token {
+	if i < 0 || i >= len(lines) {
+		return nil
+	}
+	return lines[i]
+}
+
+// renderLine returns HTML of the line with tokens wrapped into spans
+// with chroma classes and changed parts wrapped into marks.
+func renderLine(tokens []chroma.Token, changes []span) template.HTML {
+	var sb strings.Builder
+	pos, c := 0, 0 // character position in the line and index of the current change
+
+	for _, token := range tokens {
+		value := strings.TrimRight(token.Value, "\r\n")
+		if value == "" {
+			continue
+		}
+
+		class := chroma.StandardTypes[token.Type]
+		if class != "" {
+			fmt.Fprintf(&sb, `<span class="%s">`, class)
+		}
+
+		// split the token at change boundaries
+		for value != "" {
+			for c < len(changes) && changes[c].End <= pos {
+				c++
+			}
+
+			n := utf8.RuneCountInString(value)
+			changed := false
+			if c < len(changes) {
+				if changes[c].Start <= pos {
+					changed = true
+					n = minInt(n, changes[c].End-pos)
+				} else {
+					n = minInt(n, changes[c].Start-pos)
+				}
+			}
+
+			i := len(value)
+			if n < utf8.RuneCountInString(value) {
+				i = len(string([]rune(value)[:n]))
+			}
+
+			if changed {
+				sb.WriteString("<mark>" + html.EscapeString(value[:i]) + "</mark>")
+			} else {
+				sb.WriteString(html.EscapeString(value[:i]))
+			}
+
+			value = value[i:]
+			pos += n
+		}
+
+		if class != "" {
+			sb.WriteString("</span>")
+		}
+	}
+
+	return template.HTML(sb.String())
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
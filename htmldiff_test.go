@@ -0,0 +1,46 @@
+package main
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2"
+)
+
+func TestRenderLine(t *testing.T) {
+	tokens := []chroma.Token{
+		{Type: chroma.NameBuiltin, Value: "echo"},
+		{Type: chroma.Text, Value: " "},
+		{Type: chroma.LiteralStringSingle, Value: "'привет <мир>'"},
+		{Type: chroma.Punctuation, Value: ";\n"},
+	}
+
+	tests := []struct {
+		name    string
+		changes []span
+		want    template.HTML
+	}{
+		{
+			name: "no changes",
+			want: `<span class="nb">echo</span> <span class="s1">&#39;привет &lt;мир&gt;&#39;</span><span class="p">;</span>`,
+		},
+		{
+			name:    "change inside a token",
+			changes: []span{{6, 12}},
+			want:    `<span class="nb">echo</span> <span class="s1">&#39;<mark>привет</mark> &lt;мир&gt;&#39;</span><span class="p">;</span>`,
+		},
+		{
+			name:    "changes across tokens",
+			changes: []span{{2, 6}, {13, 20}},
+			want:    `<span class="nb">ec<mark>ho</mark></span><mark> </mark><span class="s1"><mark>&#39;</mark>привет <mark>&lt;мир&gt;&#39;</mark></span><span class="p"><mark>;</mark></span>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderLine(tokens, tt.changes); got != tt.want {
+				t.Errorf("renderLine() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
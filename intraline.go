@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Intraline diff granularities, see diffOptions.Intraline.
+const (
+	intralineWord = "word" // words, whitespace runs and punctuation
+	intralineChar = "char" // single characters
+	intralineNone = "none"
+)
+
+// span is a range of characters (code points) in a line, the end is excluded.
+type span struct {
+	Start int
+	End   int
+}
+
+// MarshalJSON encodes span as [start, end] to keep diff files compact.
+func (s span) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]int{s.Start, s.End})
+}
+
+// addIntraline sets Changes of deleted lines and lines added right after them,
+// paired like in the side-by-side view, see hunk.Rows.
+func addIntraline(lines []diffLine, mode string) {
+	if mode == intralineNone || mode == "" {
+		return
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].Kind == "context" {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(lines) && lines[i].Kind == "delete" {
+			i++
+		}
+		mid := i
+		for i < len(lines) && lines[i].Kind == "add" {
+			i++
+		}
+
+		deleted, added := lines[start:mid], lines[mid:i]
+		for k := 0; k < len(deleted) && k < len(added); k++ {
+			deleted[k].Changes, added[k].Changes = intralineChanges(deleted[k].Text, added[k].Text, mode)
+		}
+	}
+}
+
+// intralineChanges returns changed parts of the old and the new line.
+// Nothing is returned if lines have nothing but whitespace in common.
+func intralineChanges(a, b, mode string) (oldChanges, newChanges []span) {
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = time.Second
+
+	// diffs of tokens encoded as runes and token lengths in characters
+	var (
+		diffs            []diffmatchpatch.Diff
+		lenA, lenB       []int
+		tokensA, tokensB []string
+	)
+	if mode == intralineChar {
+		diffs = dmp.DiffCleanupSemantic(dmp.DiffMain(a, b, false))
+	} else {
+		tokensA, tokensB = splitWords(a), splitWords(b)
+		coder := runeCoder{}
+		diffs = dmp.DiffMainRunes(coder.encode(tokensA), coder.encode(tokensB), false)
+		lenA, lenB = runeLengths(tokensA), runeLengths(tokensB)
+	}
+
+	// width returns the number of characters of n tokens starting from i
+	width := func(lengths []int, i, n int) int {
+		if lengths == nil {
+			return n
+		}
+		w := 0
+		for _, l := range lengths[i : i+n] {
+			w += l
+		}
+		return w
+	}
+
+	common := false
+	var i, j int       // token positions
+	var posA, posB int // character positions
+	for _, d := range diffs {
+		n := utf8.RuneCountInString(d.Text)
+
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			text := d.Text
+			if tokensA != nil {
+				text = strings.Join(tokensA[i:i+n], "")
+			}
+			if strings.TrimSpace(text) != "" {
+				common = true
+			}
+			posA += width(lenA, i, n)
+			posB += width(lenB, j, n)
+			i += n
+			j += n
+		case diffmatchpatch.DiffDelete:
+			w := width(lenA, i, n)
+			oldChanges = appendSpan(oldChanges, span{Start: posA, End: posA + w})
+			posA += w
+			i += n
+		case diffmatchpatch.DiffInsert:
+			w := width(lenB, j, n)
+			newChanges = appendSpan(newChanges, span{Start: posB, End: posB + w})
+			posB += w
+			j += n
+		}
+	}
+
+	if !common {
+		return nil, nil
+	}
+
+	return oldChanges, newChanges
+}
+
+// appendSpan appends s to spans merging it with the last adjacent one.
+func appendSpan(spans []span, s span) []span {
+	if last := len(spans) - 1; last >= 0 && spans[last].End == s.Start {
+		spans[last].End = s.End
+		return spans
+	}
+	return append(spans, s)
+}
+
+// splitWords splits s into words of letters, digits and underscores,
+// whitespace runs and single other characters.
+func splitWords(s string) []string {
+	var tokens []string
+
+	kind := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 0
+	}
+
+	start := 0
+	for i, r := range s {
+		if i == start {
+			continue
+		}
+		prev, _ := utf8.DecodeLastRuneInString(s[:i])
+		if k := kind(r); k == 0 || k != kind(prev) {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+
+	return tokens
+}
+
+func runeLengths(tokens []string) []int {
+	lengths := make([]int, len(tokens))
+	for i, t := range tokens {
+		lengths[i] = utf8.RuneCountInString(t)
+	}
+	return lengths
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{"foo(bar_1, 2)", []string{"foo", "(", "bar_1", ",", " ", "2", ")"}},
+		{"привет, мир!", []string{"привет", ",", " ", "мир", "!"}},
+		{"naïve café  x", []string{"naïve", " ", "café", "  ", "x"}},
+		{"日本語のテキスト", []string{"日本語のテキスト"}},
+		{"ok 😀😀", []string{"ok", " ", "😀", "😀"}},
+		{"a \tb", []string{"a", " \t", "b"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitWords(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestIntralineChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		mode     string
+		old, new []span
+	}{
+		{
+			name: "changed word after non-ASCII ones",
+			a:    "привет мир",
+			b:    "привет мирок",
+			mode: intralineWord,
+			old:  []span{{7, 10}},
+			new:  []span{{7, 12}},
+		},
+		{
+			name: "added words",
+			a:    "$name = 'Ёлка';",
+			b:    "$name = 'Ёлка' . ' зимой';",
+			mode: intralineWord,
+			new:  []span{{14, 25}},
+		},
+		{
+			name: "accented character",
+			a:    "café au lait",
+			b:    "cafe au lait",
+			mode: intralineChar,
+			old:  []span{{3, 4}},
+			new:  []span{{3, 4}},
+		},
+		{
+			name: "emoji counted as single characters",
+			a:    "ok 😀 done",
+			b:    "ok 😀😀 done",
+			mode: intralineChar,
+			new:  []span{{4, 5}},
+		},
+		{
+			name: "nothing but whitespace in common",
+			a:    "один два",
+			b:    "три четыре",
+			mode: intralineWord,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, new := intralineChanges(tt.a, tt.b, tt.mode)
+			if !reflect.DeepEqual(old, tt.old) || !reflect.DeepEqual(new, tt.new) {
+				t.Errorf("intralineChanges(%q, %q) = %v, %v, want %v, %v", tt.a, tt.b, old, new, tt.old, tt.new)
+			}
+		})
+	}
+}
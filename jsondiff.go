@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// jsonDiff is a file diff written by writeDiffJSON.
+type jsonDiff struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Name       string `json:"name"`
+	OldName    string `json:"oldName,omitempty"`
+	Operation  string `json:"operation"`
+	Similarity int    `json:"similarity,omitempty"`
+	Binary     bool   `json:"binary,omitempty"`
+	TooLarge   string `json:"tooLarge,omitempty"`
+
+	OldMode   string `json:"oldMode,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	OldType   string `json:"oldType,omitempty"`
+	Type      string `json:"type,omitempty"`
+	OldTarget string `json:"oldTarget,omitempty"`
+	Target    string `json:"target,omitempty"`
+	OldCommit string `json:"oldCommit,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+
+	Structure  string      `json:"structure,omitempty"`
+	KeyChanges []keyChange `json:"keyChanges,omitempty"`
+
+	Functions []string `json:"functions,omitempty"`
+
+	Hunks []hunk `json:"hunks"`
+
+	MovedFrom []movedBlock `json:"movedFrom,omitempty"`
+	MovedTo   []movedBlock `json:"movedTo,omitempty"`
+}
+
+// diffJSONPath returns the path of the JSON diff relative to the output directory.
+func diffJSONPath(from, to, name string) string {
+	return path.Join("diffs", refDir(from), refDir(to), name+".json")
+}
+
+// writeDiffJSON writes hunks of the file with changed parts of modified lines,
+// character offsets in "changes" are counted in code points.
+func writeDiffJSON(name string, from, to ref, f file, hunks []hunk) error {
+	filePath := filepath.Join("output", filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(filePath), err)
+	}
+
+	out, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", filePath, err)
+	}
+	defer out.Close()
+
+	d := jsonDiff{
+		From:       from.Name,
+		To:         to.Name,
+		Name:       f.Name,
+		OldName:    f.OldName,
+		Operation:  f.Operation,
+		Similarity: f.Similarity,
+		Binary:     f.Binary,
+		TooLarge:   f.TooLarge,
+		OldMode:    f.OldMode,
+		Mode:       f.Mode,
+		OldType:    f.OldType,
+		Type:       f.Type,
+		OldTarget:  f.OldTarget,
+		Target:     f.Target,
+		OldCommit:  f.OldCommit,
+		Commit:     f.Commit,
+		Structure:  f.Structure,
+		KeyChanges: f.KeyChanges,
+		Functions:  f.Functions,
+		Hunks:      hunks,
+		MovedFrom:  f.MovedFrom,
+		MovedTo:    f.MovedTo,
+	}
+	if d.Hunks == nil {
+		d.Hunks = []hunk{}
+	}
+
+	if err := json.NewEncoder(out).Encode(d); err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Reasons a diff is not shown, see file.TooLarge.
+const (
+	tooLargeSize  = "size"  // a blob is larger than limits.MaxFileSize
+	tooLargeLines = "lines" // more than limits.MaxDiffLines lines changed
+	tooLargeFiles = "files" // the pair has more than limits.MaxFiles changed files
+)
+
+// limits guard against huge files and pairs, zero values mean no limit.
+type limits struct {
+	MaxFileSize  int64 // in bytes
+	MaxDiffLines int   // added and removed lines of a file
+	MaxFiles     int   // changed files of a pair
+}
+
+// tooLarge returns why the change should not be diffed, empty if it should.
+// count is the number of files of the pair already diffed.
+func (g *generator) tooLarge(change *object.Change, count int) (string, error) {
+	l := g.diffOptions.Limits
+
+	if l.MaxFiles > 0 && count >= l.MaxFiles {
+		return tooLargeFiles, nil
+	}
+
+	if l.MaxFileSize <= 0 {
+		return "", nil
+	}
+
+	for _, entry := range []object.ChangeEntry{change.From, change.To} {
+		if entry.Name == "" || !entry.TreeEntry.Mode.IsFile() {
+			continue
+		}
+
+		size, err := g.objects.EncodedObjectSize(entry.TreeEntry.Hash)
+		if err != nil {
+			return "", fmt.Errorf("get size of %s: %w", entry.TreeEntry.Hash, err)
+		}
+		if size > l.MaxFileSize {
+			return tooLargeSize, nil
+		}
+	}
+
+	return "", nil
+}
+
+// changeFiles returns files of both sides of the change without reading blobs,
+// nil for the missing side.
+func changeFiles(change *object.Change) (from, to diff.File) {
+	if entry := change.From; entry.Name != "" {
+		from = entryFile{path: entry.Name, hash: entry.TreeEntry.Hash, mode: entry.TreeEntry.Mode}
+	}
+	if entry := change.To; entry.Name != "" {
+		to = entryFile{path: entry.Name, hash: entry.TreeEntry.Hash, mode: entry.TreeEntry.Mode}
+	}
+	return from, to
+}
+
+// isSubmoduleFile reports whether the file is a submodule, which has no blob to get the size of.
+func isSubmoduleFile(f diff.File) bool {
+	return f != nil && f.Mode() == filemode.Submodule
+}
+
+// truncation summarizes files of a pair not diffed because of limits.
+type truncation struct {
+	Size  int // number of files larger than MaxFileSize
+	Lines int // number of files with more than MaxDiffLines changed lines
+	Files int // number of files over MaxFiles
+	limits
+}
+
+func newTruncation(changes []file, l limits) truncation {
+	t := truncation{limits: l}
+	for _, f := range changes {
+		switch f.TooLarge {
+		case tooLargeSize:
+			t.Size++
+		case tooLargeLines:
+			t.Lines++
+		case tooLargeFiles:
+			t.Files++
+		}
+	}
+	return t
+}
+
+// Total returns the number of files not diffed.
+func (t truncation) Total() int {
+	return t.Size + t.Lines + t.Files
+}
+
+// MaxSize returns MaxFileSize formatted like "1 MiB".
+func (l limits) MaxSize() string {
+	return formatSize(l.MaxFileSize)
+}
+
+// formatSize formats the number of bytes with binary units, e.g. "1.5 MiB".
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	s := fmt.Sprintf("%.1f", float64(n)/float64(div))
+	if s[len(s)-2:] == ".0" {
+		s = s[:len(s)-2]
+	}
+	return s + " " + string("KMGTPE"[exp]) + "iB"
+}
+
+// SizeText returns the size of the new blob like "12 KiB".
+func (f file) SizeText() string {
+	return formatSize(f.Size)
+}
+
+// OldSizeText returns the size of the old blob like "12 KiB".
+func (f file) OldSizeText() string {
+	return formatSize(f.OldSize)
+}
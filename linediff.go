@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// textChunk is a diff.Chunk of a recomputed file patch.
+type textChunk struct {
+	content string
+	op      diff.Operation
+}
+
+func (c textChunk) Content() string {
+	return c.content
+}
+
+func (c textChunk) Type() diff.Operation {
+	return c.op
+}
+
+// textFilePatch is a diff.FilePatch recomputed from decoded contents or ignoring whitespace.
+type textFilePatch struct {
+	from, to diff.File
+	chunks   []diff.Chunk
+}
+
+func (p textFilePatch) IsBinary() bool {
+	return false
+}
+
+func (p textFilePatch) Files() (from, to diff.File) {
+	return p.from, p.to
+}
+
+func (p textFilePatch) Chunks() []diff.Chunk {
+	return p.chunks
+}
+
+// patchContents returns full old and new contents of the text file patch.
+func patchContents(patch diff.FilePatch) (oldContent, newContent string) {
+	var oldSB, newSB strings.Builder
+	for _, chunk := range patch.Chunks() {
+		if chunk.Type() != diff.Add {
+			oldSB.WriteString(chunk.Content())
+		}
+		if chunk.Type() != diff.Delete {
+			newSB.WriteString(chunk.Content())
+		}
+	}
+	return oldSB.String(), newSB.String()
+}
+
+// lineDiff returns a text file patch of the contents, lines are compared
+// with whitespace normalized by mode, see normalizeWhitespace.
+// Lines that are equal after normalization are kept as context from the new content.
+func lineDiff(from, to diff.File, oldContent, newContent, whitespace string) diff.FilePatch {
+	oldLines := splitLinesKeepEOL(oldContent)
+	newLines := splitLinesKeepEOL(newContent)
+
+	normalize := func(lines []string) []string {
+		keys := make([]string, len(lines))
+		for i, line := range lines {
+			keys[i] = normalizeWhitespace(line, whitespace)
+		}
+		return keys
+	}
+
+	coder := runeCoder{}
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = time.Hour
+	diffs := dmp.DiffMainRunes(coder.encode(normalize(oldLines)), coder.encode(normalize(newLines)), false)
+
+	result := textFilePatch{from: from, to: to}
+
+	var i, j int // positions in old and new lines
+	for _, d := range diffs {
+		n := utf8.RuneCountInString(d.Text)
+
+		var lines []string
+		var op diff.Operation
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			lines, op = newLines[j:j+n], diff.Equal
+			i += n
+			j += n
+		case diffmatchpatch.DiffDelete:
+			lines, op = oldLines[i:i+n], diff.Delete
+			i += n
+		case diffmatchpatch.DiffInsert:
+			lines, op = newLines[j:j+n], diff.Add
+			j += n
+		}
+
+		content := strings.Join(lines, "")
+		if last := len(result.chunks) - 1; last >= 0 && result.chunks[last].Type() == op {
+			result.chunks[last] = textChunk{content: result.chunks[last].Content() + content, op: op}
+			continue
+		}
+		result.chunks = append(result.chunks, textChunk{content: content, op: op})
+	}
+
+	return result
+}
+
+// runeCoder encodes every distinct string as a rune to diff lines or words as text.
+type runeCoder map[string]rune
+
+func (c runeCoder) encode(keys []string) []rune {
+	runes := make([]rune, len(keys))
+	for i, key := range keys {
+		code, ok := c[key]
+		if !ok {
+			code = rune(len(c) + 1)
+			if code >= 0xD800 {
+				code += 0x800 // skip surrogates
+			}
+			c[key] = code
+		}
+		runes[i] = code
+	}
+	return runes
+}
+
+// splitLinesKeepEOL splits s into lines keeping line endings.
+func splitLinesKeepEOL(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name       string
+		oldContent string
+		newContent string
+		whitespace string
+		want       []diff.Chunk
+	}{
+		{
+			name:       "changed line",
+			oldContent: "a\nb\nc\n",
+			newContent: "a\nB\nc\n",
+			want: []diff.Chunk{
+				textChunk{content: "a\n", op: diff.Equal},
+				textChunk{content: "b\n", op: diff.Delete},
+				textChunk{content: "B\n", op: diff.Add},
+				textChunk{content: "c\n", op: diff.Equal},
+			},
+		},
+		{
+			name:       "amount keeps context from the new content",
+			oldContent: "if a {\n\tb()\n}\n",
+			newContent: "if  a {\n\tb()  \n}\n",
+			whitespace: whitespaceAmount,
+			want: []diff.Chunk{
+				textChunk{content: "if  a {\n\tb()  \n}\n", op: diff.Equal},
+			},
+		},
+		{
+			name:       "amount keeps leading whitespace",
+			oldContent: "a\nb\n",
+			newContent: "a\n  b\n",
+			whitespace: whitespaceAmount,
+			want: []diff.Chunk{
+				textChunk{content: "a\n", op: diff.Equal},
+				textChunk{content: "b\n", op: diff.Delete},
+				textChunk{content: "  b\n", op: diff.Add},
+			},
+		},
+		{
+			name:       "eol ignores carriage returns",
+			oldContent: "a\r\nb\r\n",
+			newContent: "a\nb c\n",
+			whitespace: whitespaceEOL,
+			want: []diff.Chunk{
+				textChunk{content: "a\n", op: diff.Equal},
+				textChunk{content: "b\r\n", op: diff.Delete},
+				textChunk{content: "b c\n", op: diff.Add},
+			},
+		},
+		{
+			name:       "eol keeps other whitespace",
+			oldContent: "a\r\n",
+			newContent: "a \n",
+			whitespace: whitespaceEOL,
+			want: []diff.Chunk{
+				textChunk{content: "a\r\n", op: diff.Delete},
+				textChunk{content: "a \n", op: diff.Add},
+			},
+		},
+		{
+			name:       "no trailing newline",
+			oldContent: "a\nb",
+			newContent: "a\nc",
+			whitespace: whitespaceAmount,
+			want: []diff.Chunk{
+				textChunk{content: "a\n", op: diff.Equal},
+				textChunk{content: "b", op: diff.Delete},
+				textChunk{content: "c", op: diff.Add},
+			},
+		},
+		{
+			name:       "added trailing newline is ignored with whitespace",
+			oldContent: "a\nb",
+			newContent: "a\nb\n",
+			whitespace: whitespaceEOL,
+			want: []diff.Chunk{
+				textChunk{content: "a\nb\n", op: diff.Equal},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lineDiff(nil, nil, tt.oldContent, tt.newContent, tt.whitespace).Chunks()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lineDiff() chunks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
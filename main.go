@@ -6,8 +6,11 @@ import (
 	"html/template"
 	"log"
 	"path/filepath"
+	"regexp"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage/memory"
 	flags "github.com/jessevdk/go-flags"
 )
@@ -16,10 +19,52 @@ import (
 var templates embed.FS
 
 type config struct {
-	RepoURL      string `env:"REPO_URL" long:"url" description:"URL of the repository to clone" default:"https://github.com/ilyabirman/Aegea-Comparisons"`
-	RepoPath     string `env:"REPO_PATH" long:"path" description:"Path to the repository to read"`
-	TemplatesDir string `env:"TEMPLATES_DIR" long:"templates" description:"Directory with templates"`
-	CopyFiles    bool   `env:"COPY_FILES" long:"copy" description:"Copy files per each tag into the output directory"`
+	RepoURL       string   `env:"REPO_URL" long:"url" description:"URL of the repository to clone" default:"https://github.com/ilyabirman/Aegea-Comparisons"`
+	RepoPath      string   `env:"REPO_PATH" long:"path" description:"Path to the repository to read"`
+	TemplatesDir  string   `env:"TEMPLATES_DIR" long:"templates" description:"Directory with templates"`
+	CopyFiles     bool     `env:"COPY_FILES" long:"copy" description:"Copy files per each tag into the output directory"`
+	Manifests     bool     `env:"MANIFESTS" long:"manifests" description:"Write a manifest of files per each ref, to compute changes between any refs in the browser"`
+	NoFiles       bool     `env:"NO_FILES" long:"no-files" description:"Skip rendering files lists, use with --manifests"`
+	Patches       bool     `env:"PATCHES" long:"patches" description:"Write unified diffs per each pair and per each changed file"`
+	HTMLDiffs     bool     `env:"HTML_DIFFS" long:"html-diffs" description:"Render static diff pages per each changed file, viewable without JavaScript"`
+	JSONDiffs     bool     `env:"JSON_DIFFS" long:"json-diffs" description:"Write JSON diffs per each changed file"`
+	Intraline     string   `env:"INTRALINE" long:"intraline" description:"Granularity of changes highlighted within modified lines" choice:"word" choice:"char" choice:"none" default:"word"`
+	DiffView      string   `env:"DIFF_VIEW" long:"diff-view" description:"Layout of static diff pages" choice:"side-by-side" choice:"unified" default:"side-by-side"`
+	Whitespace    string   `env:"IGNORE_WHITESPACE" long:"ignore-whitespace" description:"Ignore whitespace changes when comparing files" choice:"all" choice:"amount" choice:"eol"`
+	Hidden        string   `env:"HIDDEN" long:"hidden" description:"What to do with generated and vendored files marked in .gitattributes, and files matching .diffignore" choice:"collapse" choice:"exclude" choice:"show" default:"collapse"`
+	IgnoreFile    string   `env:"IGNORE_FILE" long:"ignore-file" description:"File with .gitignore-style patterns of files to hide, in addition to .diffignore of compared refs"`
+	Encodings     []string `env:"ENCODINGS" env-delim:"," long:"encoding" description:"Encoding of non-UTF-8 files matching the glob, or the regex with re: prefix, e.g. *.php:windows-1251, can be repeated"`
+	Guesses       []string `env:"GUESS_ENCODINGS" env-delim:"," long:"guess-encoding" description:"Encoding to try for other non-UTF-8 files, the most plausible one is used, can be repeated" default:"windows-1252" default:"windows-1251" default:"koi8-r"`
+	Order         string   `env:"TAG_ORDER" long:"order" description:"How to order tags" choice:"version" choice:"regex" choice:"date" choice:"topo" default:"version"`
+	OrderRegex    string   `env:"TAG_ORDER_REGEX" long:"order-regex" description:"Regex with a named group \"version\" to extract version from tag name, used with --order=regex"`
+	Include       []string `env:"TAG_INCLUDE" env-delim:"," long:"include" description:"Compare only tags matching the glob, or the regex with re: prefix, can be repeated"`
+	Exclude       []string `env:"TAG_EXCLUDE" env-delim:"," long:"exclude" description:"Skip tags matching the glob, or the regex with re: prefix, can be repeated"`
+	NoPrereleases bool     `env:"NO_PRERELEASES" long:"no-prereleases" description:"Skip pre-release tags, e.g. 1.0.0-rc.1"`
+	Last          int      `env:"LAST" long:"last" description:"Compare only the newest N tags, 0 means no limit"`
+	Branches      bool     `env:"BRANCHES" long:"branches" description:"Compare local branches too"`
+	Remotes       bool     `env:"REMOTES" long:"remotes" description:"Compare remote-tracking branches too"`
+	Refs          []string `env:"REFS" env-delim:"," long:"ref" description:"Reference or revision to compare too, e.g. refs/pull/1/head, can be repeated"`
+	Commits       string   `env:"COMMITS" long:"commits" description:"Compare every commit along the first-parent history of the branch or revision"`
+	CommitsLimit  int      `env:"COMMITS_LIMIT" long:"commits-limit" description:"Maximum number of commits to compare, 0 means no limit" default:"20"`
+	CommitsSince  string   `env:"COMMITS_SINCE" long:"commits-since" description:"Skip commits older than the date, YYYY-MM-DD"`
+	Index         bool     `env:"INDEX" long:"index" description:"Compare the staging index too, as INDEX, requires --path"`
+	Worktree      bool     `env:"WORKTREE" long:"worktree" description:"Compare the working tree too, as WORKTREE, requires --path"`
+	Pairs         string   `env:"PAIRS" long:"pairs" description:"Which pairs of refs to compare" choice:"all" choice:"adjacent" choice:"latest" choice:"previous" default:"all"`
+	PairsPrevious int      `env:"PAIRS_PREVIOUS" long:"pairs-previous" description:"Number of older refs to compare each ref against, used with --pairs=previous" default:"3"`
+	NoRenames     bool     `env:"NO_RENAMES" long:"no-renames" description:"Don't detect renamed files"`
+	ExactRenames  bool     `env:"EXACT_RENAMES" long:"exact-renames" description:"Detect only renamed and copied files with unchanged content"`
+	RenameScore   uint     `env:"RENAME_SCORE" long:"rename-score" description:"Minimum similarity in percent for a file to be considered renamed or copied" default:"60"`
+	RenameLimit   uint     `env:"RENAME_LIMIT" long:"rename-limit" description:"Maximum number of added and deleted files to compare for renames and copies, 0 means no limit"`
+	Copies        bool     `env:"COPIES" long:"copies" description:"Detect files copied from modified files"`
+	CopiesHarder  bool     `env:"COPIES_HARDER" long:"copies-harder" description:"Detect files copied from any file, slow for big repositories"`
+	Moved         bool     `env:"MOVED" long:"moved" description:"Detect blocks of lines moved between files"`
+	MovedLines    uint     `env:"MOVED_LINES" long:"moved-lines" description:"Minimum number of non-blank lines in a moved block" default:"3"`
+	MaxFileSize   int64    `env:"MAX_FILE_SIZE" long:"max-file-size" description:"Don't diff files larger than N bytes, 0 means no limit" default:"1048576"`
+	MaxDiffLines  int      `env:"MAX_DIFF_LINES" long:"max-diff-lines" description:"Don't show diffs of more than N changed lines, 0 means no limit" default:"20000"`
+	MaxFiles      int      `env:"MAX_FILES" long:"max-files" description:"Don't diff more than N files in a pair, 0 means no limit" default:"3000"`
+	Structured    bool     `env:"STRUCTURED" long:"structured" description:"Compare JSON, YAML, INI and PHP array config files by keys too"`
+	Funcname      []string `env:"FUNCNAME" long:"funcname" description:"Regex of function lines for hunk headers in files matching the glob, or the regex with re: prefix, e.g. *.tpl=^{block (.*)}, can be repeated"`
+	Compare       string   `env:"COMPARE" long:"compare" description:"Compare refs directly (two-dot) or since the merge base (three-dot)" choice:"two-dot" choice:"three-dot" choice:"both" default:"two-dot"`
 }
 
 func main() {
@@ -57,10 +102,117 @@ func run() error {
 		}
 	}
 
+	refOpts := refOptions{
+		Tags: tagOptions{
+			Order:         cfg.Order,
+			NoPrereleases: cfg.NoPrereleases,
+			Last:          cfg.Last,
+		},
+		Branches: cfg.Branches,
+		Remotes:  cfg.Remotes,
+		Refs:     cfg.Refs,
+
+		Commits:      cfg.Commits,
+		CommitsLimit: cfg.CommitsLimit,
+
+		Index:    cfg.Index,
+		Worktree: cfg.Worktree,
+	}
+	if (cfg.Index || cfg.Worktree) && cfg.RepoPath == "" {
+		return fmt.Errorf("--index and --worktree require --path")
+	}
+	if refOpts.Tags.Include, err = parseNamePatterns(cfg.Include); err != nil {
+		return fmt.Errorf("parse include patterns: %w", err)
+	}
+	if refOpts.Tags.Exclude, err = parseNamePatterns(cfg.Exclude); err != nil {
+		return fmt.Errorf("parse exclude patterns: %w", err)
+	}
+	if cfg.CommitsSince != "" {
+		refOpts.CommitsSince, err = time.Parse("2006-01-02", cfg.CommitsSince)
+		if err != nil {
+			return fmt.Errorf("parse commits since date: %w", err)
+		}
+	}
+	if cfg.OrderRegex != "" {
+		refOpts.Tags.OrderRegex, err = regexp.Compile(cfg.OrderRegex)
+		if err != nil {
+			return fmt.Errorf("parse order regex: %w", err)
+		}
+	}
+
+	if cfg.RenameScore > 100 {
+		return fmt.Errorf("rename score should be between 0 and 100, got %d", cfg.RenameScore)
+	}
+
+	var encodings encodingOptions
+	if encodings.Rules, err = parseEncodingRules(cfg.Encodings); err != nil {
+		return fmt.Errorf("parse encodings: %w", err)
+	}
+	if encodings.Guesses, err = parseEncodings(cfg.Guesses); err != nil {
+		return fmt.Errorf("parse guess encodings: %w", err)
+	}
+
+	funcname, err := parseFuncnameRules(cfg.Funcname)
+	if err != nil {
+		return fmt.Errorf("parse funcname rules: %w", err)
+	}
+
+	if cfg.NoFiles && !cfg.Manifests {
+		return fmt.Errorf("--no-files requires --manifests")
+	}
+
+	ignore, err := readIgnoreFile(cfg.IgnoreFile)
+	if err != nil {
+		return fmt.Errorf("read ignore file: %w", err)
+	}
+
+	movedLines := 0
+	if cfg.Moved {
+		movedLines = int(cfg.MovedLines)
+		if movedLines == 0 {
+			return fmt.Errorf("--moved-lines should be positive")
+		}
+	}
+
 	g := generator{
-		repo:      repo,
-		tmpl:      tmpl,
-		copyFiles: cfg.CopyFiles,
+		repo:       repo,
+		tmpl:       tmpl,
+		copyFiles:  cfg.CopyFiles,
+		manifests:  cfg.Manifests,
+		noFiles:    cfg.NoFiles,
+		patches:    cfg.Patches,
+		htmlDiffs:  cfg.HTMLDiffs,
+		jsonDiffs:  cfg.JSONDiffs,
+		refOptions: refOpts,
+		pairOptions: pairOptions{
+			Strategy: cfg.Pairs,
+			Previous: cfg.PairsPrevious,
+			Compare:  cfg.Compare,
+		},
+		encodings: encodings,
+		diffOptions: diffOptions{
+			Tree: object.DiffTreeOptions{
+				DetectRenames:    !cfg.NoRenames,
+				RenameScore:      cfg.RenameScore,
+				RenameLimit:      cfg.RenameLimit,
+				OnlyExactRenames: cfg.ExactRenames,
+			},
+			Copies:       cfg.Copies,
+			CopiesHarder: cfg.CopiesHarder,
+			MovedLines:   movedLines,
+			Hidden:       cfg.Hidden,
+			Ignore:       ignore,
+			View:         cfg.DiffView,
+			Intraline:    cfg.Intraline,
+			Whitespace:   cfg.Whitespace,
+			Structured:   cfg.Structured,
+			Funcname:     funcname,
+			Limits: limits{
+				MaxFileSize:  cfg.MaxFileSize,
+				MaxDiffLines: cfg.MaxDiffLines,
+				MaxFiles:     cfg.MaxFiles,
+			},
+		},
 	}
 
 	if err = g.Run(); err != nil {
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// manifestEntry is a file in the ref tree, it is encoded
+// as a compact JSON array: ["<blob hash>", "<mode>", <size>, <binary>].
+type manifestEntry struct {
+	Hash   string
+	Mode   string
+	Size   int64
+	Binary bool
+}
+
+func (e manifestEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Hash, e.Mode, e.Size, e.Binary})
+}
+
+// writeManifests writes `output/manifests/<ref>.json` for every ref
+// with a map of file path to manifestEntry, so the browser
+// can compute changes between any two refs.
+func (g *generator) writeManifests(refs []ref) error {
+	binaries := map[plumbing.Hash]bool{} // blobs are mostly the same in all refs
+	for _, r := range refs {
+		log.Printf("Writing manifest for %s", r.Name)
+		if err := g.writeManifest(r, binaries); err != nil {
+			return fmt.Errorf("write manifest for %s %q: %w", r.Kind, r.Name, err)
+		}
+	}
+	return nil
+}
+
+func (g *generator) writeManifest(r ref, binaries map[plumbing.Hash]bool) error {
+	tree, err := g.tree(r)
+	if err != nil {
+		return fmt.Errorf("get tree: %w", err)
+	}
+
+	manifest := map[string]manifestEntry{}
+	err = tree.Files().ForEach(func(file *object.File) error {
+		binary, ok := binaries[file.Hash]
+		if !ok {
+			// files with UTF-16 byte order marks are decoded, not binary
+			head, err := g.readBlob(file.Hash, 8000)
+			if err != nil {
+				return err
+			}
+			binary = isBinary(head) && !hasUTF16BOM(head)
+			binaries[file.Hash] = binary
+		}
+
+		manifest[file.Name] = manifestEntry{
+			Hash:   file.Hash.String(),
+			Mode:   file.Mode.String(),
+			Size:   file.Size,
+			Binary: binary,
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("iterate files: %w", err)
+	}
+
+	filePath := filepath.Join("output", filepath.FromSlash(path.Join("manifests", refDir(r.Name)+".json")))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(filePath), err)
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(manifest); err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Types of tree entries, see file.Type.
+const (
+	typeFile      = "file"
+	typeSymlink   = "symlink"
+	typeSubmodule = "submodule"
+)
+
+// entryFile is a diff.File of a tree entry, used for submodules
+// which go-git patches have no files for.
+type entryFile struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (f entryFile) Hash() plumbing.Hash {
+	return f.hash
+}
+
+func (f entryFile) Mode() filemode.FileMode {
+	return f.mode
+}
+
+func (f entryFile) Path() string {
+	return f.path
+}
+
+func entryType(mode filemode.FileMode) string {
+	switch mode {
+	case filemode.Empty:
+		return ""
+	case filemode.Symlink:
+		return typeSymlink
+	case filemode.Submodule:
+		return typeSubmodule
+	}
+	return typeFile
+}
+
+// modeString formats the mode like git does, e.g. "100644", empty for missing entries.
+func modeString(mode filemode.FileMode) string {
+	if mode == filemode.Empty {
+		return ""
+	}
+	return fmt.Sprintf("%06o", uint32(mode))
+}
+
+// isSubmoduleChange reports whether any side of the change is a submodule.
+func isSubmoduleChange(change *object.Change) bool {
+	return change.From.TreeEntry.Mode == filemode.Submodule || change.To.TreeEntry.Mode == filemode.Submodule
+}
+
+// submodulePatch returns a patch of the change with a submodule on any side,
+// submodules are compared as "Subproject commit <hash>" lines, like `git diff` does.
+func (g *generator) submodulePatch(change *object.Change) (diff.FilePatch, error) {
+	var (
+		from, to               diff.File
+		oldContent, newContent string
+	)
+
+	side := func(entry object.ChangeEntry) (diff.File, string, error) {
+		if entry.Name == "" {
+			return nil, "", nil
+		}
+
+		f := entryFile{path: entry.Name, hash: entry.TreeEntry.Hash, mode: entry.TreeEntry.Mode}
+		if entry.TreeEntry.Mode == filemode.Submodule {
+			return f, fmt.Sprintf("Subproject commit %s\n", entry.TreeEntry.Hash), nil
+		}
+
+		content, err := g.readBlob(entry.TreeEntry.Hash, -1)
+		if err != nil {
+			return nil, "", err
+		}
+		if isBinary(content) {
+			return f, "", nil
+		}
+		return f, string(content), nil
+	}
+
+	from, oldContent, err := side(change.From)
+	if err != nil {
+		return nil, err
+	}
+	to, newContent, err = side(change.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return lineDiff(from, to, oldContent, newContent, ""), nil
+}
+
+// setModes sets modes, types, symlink targets and submodule commits of the changed file,
+// and marks type changes, submodule updates and mode-only changes with T, S and X operations.
+func (g *generator) setModes(f *file, change *object.Change) error {
+	oldEntry, newEntry := change.From.TreeEntry, change.To.TreeEntry
+
+	f.OldMode, f.Mode = modeString(oldEntry.Mode), modeString(newEntry.Mode)
+	f.OldType, f.Type = entryType(oldEntry.Mode), entryType(newEntry.Mode)
+
+	for _, s := range []struct {
+		entry  object.TreeEntry
+		target *string
+		commit *string
+	}{
+		{oldEntry, &f.OldTarget, &f.OldCommit},
+		{newEntry, &f.Target, &f.Commit},
+	} {
+		switch s.entry.Mode {
+		case filemode.Symlink:
+			target, err := g.readBlob(s.entry.Hash, -1)
+			if err != nil {
+				return fmt.Errorf("read symlink: %w", err)
+			}
+			*s.target = string(target)
+		case filemode.Submodule:
+			*s.commit = s.entry.Hash.String()
+		}
+	}
+
+	if f.OldType == "" || f.Type == "" {
+		return nil
+	}
+
+	switch {
+	case f.OldType != f.Type:
+		f.Operation = "T"
+	case f.Operation == "M" && f.Type == typeSubmodule:
+		f.Operation = "S"
+	case f.Operation == "M" && oldEntry.Hash == newEntry.Hash && oldEntry.Mode != newEntry.Mode:
+		f.Operation = "X"
+	}
+
+	return nil
+}
+
+// ModeChange returns e.g. "100644 → 100755" if the mode changed, empty otherwise.
+func (f file) ModeChange() string {
+	if f.OldMode == "" || f.Mode == "" || f.OldMode == f.Mode {
+		return ""
+	}
+	return f.OldMode + " → " + f.Mode
+}
+
+// TypeChange returns e.g. "file → symlink" if the type changed, empty otherwise.
+func (f file) TypeChange() string {
+	if f.OldType == "" || f.Type == "" || f.OldType == f.Type {
+		return ""
+	}
+	return f.OldType + " → " + f.Type
+}
+
+// CommitChange returns short hashes of old and new submodule commits, e.g. "1a2b3c4 → 5d6e7f8".
+func (f file) CommitChange() string {
+	short := func(hash string) string {
+		if len(hash) > 7 {
+			return hash[:7]
+		}
+		return hash
+	}
+
+	switch {
+	case f.OldCommit != "" && f.Commit != "":
+		return short(f.OldCommit) + " → " + short(f.Commit)
+	case f.Commit != "":
+		return short(f.Commit)
+	}
+	return short(f.OldCommit)
+}
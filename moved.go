@@ -0,0 +1,208 @@
+package main
+
+import (
+	"hash/fnv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// movedBlock is a block of lines deleted from one file and added to another one,
+// or to another place of the same file.
+type movedBlock struct {
+	Name     string `json:"name"`     // the other file: the source for MovedFrom, the destination for MovedTo
+	OldStart int    `json:"oldStart"` // first line of the block in the old source file
+	NewStart int    `json:"newStart"` // first line of the block in the new destination file
+	Lines    int    `json:"lines"`
+
+	DiffPage string `json:"-"` // URL of the static diff page of the other file, set if rendered
+}
+
+// OldEnd returns the last line of the block in the old source file.
+func (b movedBlock) OldEnd() int {
+	return b.OldStart + b.Lines - 1
+}
+
+// NewEnd returns the last line of the block in the new destination file.
+func (b movedBlock) NewEnd() int {
+	return b.NewStart + b.Lines - 1
+}
+
+// MovedFromFiles returns names of files lines were moved from, comma separated.
+func (f file) MovedFromFiles() string {
+	return movedFiles(f.MovedFrom)
+}
+
+// MovedToFiles returns names of files lines were moved to, comma separated.
+func (f file) MovedToFiles() string {
+	return movedFiles(f.MovedTo)
+}
+
+func movedFiles(blocks []movedBlock) string {
+	var names []string
+	seen := map[string]bool{}
+	for _, b := range blocks {
+		if !seen[b.Name] {
+			seen[b.Name] = true
+			names = append(names, b.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// movedLine is a deleted or added line, lines of the same run
+// are consecutive lines of one chunk.
+type movedLine struct {
+	file   int // index in changes
+	number int // line number in the old file for deleted lines and in the new one for added lines
+	run    int
+	text   string // without surrounding whitespace, reindented lines are moved too
+}
+
+// maxMoveCandidates limits the number of places a block is looked for,
+// so that common runs of lines like closing braces don't make detection quadratic.
+const maxMoveCandidates = 16
+
+// detectMoves finds blocks of at least minLines non-blank lines deleted from one file
+// and added to another place, and sets MovedFrom and MovedTo of changes.
+// Blocks are matched greedily in order of added lines, preferring longest matches.
+// Like git, a match only starts at a run of minLines non-blank lines, found by its hash,
+// and only the first maxMoveCandidates places of the run are tried.
+func detectMoves(changes []file, minLines int) {
+	deleted, added := changedLines(changes)
+
+	if minLines < 1 {
+		minLines = 1
+	}
+
+	index := map[uint64][]int{}
+	for d := range deleted {
+		if key, ok := runKey(deleted, d, minLines); ok {
+			index[key] = append(index[key], d)
+		}
+	}
+
+	moved := make([]bool, len(deleted))
+	for i := 0; i < len(added); {
+		key, ok := runKey(added, i, minLines)
+		if !ok {
+			i++
+			continue
+		}
+
+		// places are mostly moved in order, moved ones are dropped from the front
+		candidates := index[key]
+		for len(candidates) > 0 && moved[candidates[0]] {
+			candidates = candidates[1:]
+		}
+		index[key] = candidates
+		if len(candidates) > maxMoveCandidates {
+			candidates = candidates[:maxMoveCandidates]
+		}
+
+		bestStart, bestLen, bestLines := 0, 0, 0
+		for _, d := range candidates {
+			// lines replaced in place, e.g. reindented, are not moved
+			if moved[d] || deleted[d].file == added[i].file && deleted[d].run+1 == added[i].run {
+				continue
+			}
+
+			n, nonBlank := 0, 0
+			for i+n < len(added) && d+n < len(deleted) &&
+				!moved[d+n] &&
+				added[i+n].run == added[i].run &&
+				deleted[d+n].run == deleted[d].run &&
+				added[i+n].text == deleted[d+n].text {
+				if added[i+n].text != "" {
+					nonBlank++
+				}
+				n++
+			}
+			if nonBlank > bestLines {
+				bestStart, bestLen, bestLines = d, n, nonBlank
+			}
+		}
+
+		if bestLines < minLines {
+			i++
+			continue
+		}
+
+		// trailing blank lines are not part of the block
+		for added[i+bestLen-1].text == "" {
+			bestLen--
+		}
+
+		for k := 0; k < bestLen; k++ {
+			moved[bestStart+k] = true
+		}
+
+		src, dst := deleted[bestStart], added[i]
+		changes[dst.file].MovedFrom = append(changes[dst.file].MovedFrom, movedBlock{
+			Name:     changes[src.file].path(),
+			OldStart: src.number,
+			NewStart: dst.number,
+			Lines:    bestLen,
+		})
+		changes[src.file].MovedTo = append(changes[src.file].MovedTo, movedBlock{
+			Name:     changes[dst.file].path(),
+			OldStart: src.number,
+			NewStart: dst.number,
+			Lines:    bestLen,
+		})
+
+		i += bestLen
+	}
+}
+
+// runKey returns the hash of n non-blank lines starting at the non-blank line i
+// within its run, false if the line is blank or the run is shorter.
+func runKey(lines []movedLine, i, n int) (uint64, bool) {
+	if lines[i].text == "" {
+		return 0, false
+	}
+
+	h := fnv.New64a()
+	for j, count := i, 0; count < n; j++ {
+		if j >= len(lines) || lines[j].run != lines[i].run {
+			return 0, false
+		}
+		if lines[j].text == "" {
+			continue
+		}
+		h.Write([]byte(lines[j].text))
+		h.Write([]byte{0})
+		count++
+	}
+	return h.Sum64(), true
+}
+
+// changedLines returns deleted and added lines of text files.
+func changedLines(changes []file) (deleted, added []movedLine) {
+	run := 0
+	for i, f := range changes {
+		if f.Binary || f.WhitespaceOnly || f.TooLarge != "" {
+			continue
+		}
+
+		oldNumber, newNumber := 0, 0
+		for _, chunk := range f.patch.Chunks() {
+			run++
+			for _, text := range splitLines(chunk.Content()) {
+				switch chunk.Type() {
+				case diff.Equal:
+					oldNumber++
+					newNumber++
+				case diff.Delete:
+					oldNumber++
+					deleted = append(deleted, movedLine{file: i, number: oldNumber, run: run, text: strings.TrimSpace(text)})
+				case diff.Add:
+					newNumber++
+					added = append(added, movedLine{file: i, number: newNumber, run: run, text: strings.TrimSpace(text)})
+				}
+			}
+		}
+	}
+
+	return deleted, added
+}
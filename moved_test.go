@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectMoves(t *testing.T) {
+	type content struct {
+		name     string
+		old, new string
+	}
+
+	tests := []struct {
+		name  string
+		files []content
+		from  map[string][]movedBlock // MovedFrom by file name
+		to    map[string][]movedBlock // MovedTo by file name
+	}{
+		{
+			name: "block moved across files",
+			files: []content{
+				{"a.go", "x\nl1\nl2\nl3\ny\n", "x\ny\n"},
+				{"b.go", "p\n", "p\nl1\nl2\nl3\n"},
+			},
+			from: map[string][]movedBlock{"b.go": {{Name: "a.go", OldStart: 2, NewStart: 2, Lines: 3}}},
+			to:   map[string][]movedBlock{"a.go": {{Name: "b.go", OldStart: 2, NewStart: 2, Lines: 3}}},
+		},
+		{
+			name: "block moved within one file",
+			files: []content{
+				{"a.go", "l1\nl2\nl3\nw\nx\ny\nz\n", "w\nx\ny\nz\nl1\nl2\nl3\n"},
+			},
+			from: map[string][]movedBlock{"a.go": {{Name: "a.go", OldStart: 1, NewStart: 5, Lines: 3}}},
+			to:   map[string][]movedBlock{"a.go": {{Name: "a.go", OldStart: 1, NewStart: 5, Lines: 3}}},
+		},
+		{
+			name: "reindented block",
+			files: []content{
+				{"a.go", "x\nl1\nl2\nl3\ny\n", "x\ny\n"},
+				{"b.go", "p\n", "p\n\tl1\n\tl2\n\tl3\n"},
+			},
+			from: map[string][]movedBlock{"b.go": {{Name: "a.go", OldStart: 2, NewStart: 2, Lines: 3}}},
+			to:   map[string][]movedBlock{"a.go": {{Name: "b.go", OldStart: 2, NewStart: 2, Lines: 3}}},
+		},
+		{
+			name: "block replaced in place",
+			files: []content{
+				{"a.go", "x\nl1\nl2\nl3\ny\n", "x\n\tl1\n\tl2\n\tl3\ny\n"},
+			},
+		},
+		{
+			name: "too short block",
+			files: []content{
+				{"a.go", "x\nl1\nl2\ny\n", "x\ny\n"},
+				{"b.go", "p\n", "p\nl1\nl2\n"},
+			},
+		},
+		{
+			name: "trailing blank lines are not part of the block",
+			files: []content{
+				{"a.go", "x\nl1\n\nl2\nl3\n\ny\n", "x\ny\n"},
+				{"b.go", "p\n", "p\nl1\n\nl2\nl3\n\n"},
+			},
+			from: map[string][]movedBlock{"b.go": {{Name: "a.go", OldStart: 2, NewStart: 2, Lines: 4}}},
+			to:   map[string][]movedBlock{"a.go": {{Name: "b.go", OldStart: 2, NewStart: 2, Lines: 4}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := make([]file, len(tt.files))
+			for i, c := range tt.files {
+				changes[i] = file{Name: c.name, OldName: c.name, Operation: "M", patch: lineDiff(nil, nil, c.old, c.new, "")}
+			}
+
+			detectMoves(changes, 3)
+
+			for _, f := range changes {
+				if !reflect.DeepEqual(f.MovedFrom, tt.from[f.Name]) {
+					t.Errorf("%s MovedFrom = %+v, want %+v", f.Name, f.MovedFrom, tt.from[f.Name])
+				}
+				if !reflect.DeepEqual(f.MovedTo, tt.to[f.Name]) {
+					t.Errorf("%s MovedTo = %+v, want %+v", f.Name, f.MovedTo, tt.to[f.Name])
+				}
+			}
+		})
+	}
+}
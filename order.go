@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Tag ordering strategies, see tagOptions.Order.
+const (
+	orderVersion = "version" // tag name parsed as a version
+	orderRegex   = "regex"   // "version" named group of tagOptions.OrderRegex
+	orderDate    = "date"    // tagger date for annotated tags, author date of the commit otherwise
+	orderTopo    = "topo"    // position along first-parent history
+)
+
+type tagOptions struct {
+	Order      string
+	OrderRegex *regexp.Regexp
+
+	Include       []namePattern // keep only tags matching any of the patterns
+	Exclude       []namePattern // skip tags matching any of the patterns
+	NoPrereleases bool          // skip tags with SemVer pre-release identifiers, e.g. "1.0.0-rc.1"
+	Last          int           // keep only the newest tags, 0 means no limit
+}
+
+// sortTags orders tags newest first using the configured strategy.
+// Tags for which the strategy yields no key go last, sorted by name.
+// Tags with equal keys are sorted by name too.
+func sortTags(r *git.Repository, tags []ref, opts tagOptions) error {
+	var (
+		cmp func(a, b ref) int
+		err error
+	)
+
+	switch opts.Order {
+	case orderVersion, "":
+		cmp = versionOrder(func(t ref) string { return t.Name })
+	case orderRegex:
+		cmp, err = regexOrder(opts.OrderRegex)
+	case orderDate:
+		cmp = dateOrder
+	case orderTopo:
+		cmp, err = topoOrder(r, tags)
+	default:
+		err = fmt.Errorf("unknown order %q", opts.Order)
+	}
+	if err != nil {
+		return err
+	}
+
+	sortRefs(tags, cmp)
+
+	return nil
+}
+
+// sortRefs orders refs by cmp descending, refs with equal keys are sorted by name.
+func sortRefs(refs []ref, cmp func(a, b ref) int) {
+	sort.SliceStable(refs, func(i, j int) bool {
+		if c := cmp(refs[i], refs[j]); c != 0 {
+			return c > 0
+		}
+		return refs[i].Name < refs[j].Name
+	})
+}
+
+// versionOrder compares tags by the version parsed from key(ref),
+// see compareVersions.
+func versionOrder(key func(t ref) string) func(a, b ref) int {
+	versions := map[string]version{}
+	get := func(t ref) version {
+		v, ok := versions[t.Name]
+		if !ok {
+			v = parseVersion(key(t))
+			versions[t.Name] = v
+		}
+		return v
+	}
+
+	return func(a, b ref) int {
+		return compareVersions(get(a), get(b))
+	}
+}
+
+func regexOrder(re *regexp.Regexp) (func(a, b ref) int, error) {
+	if re == nil {
+		return nil, fmt.Errorf("order regex is not set")
+	}
+
+	i := re.SubexpIndex("version")
+	if i < 0 {
+		return nil, fmt.Errorf("order regex %q has no named group \"version\"", re)
+	}
+
+	return versionOrder(func(t ref) string {
+		m := re.FindStringSubmatch(t.Name)
+		if m == nil {
+			return ""
+		}
+		return m[i]
+	}), nil
+}
+
+func dateOrder(a, b ref) int {
+	switch {
+	case a.Date.Before(b.Date):
+		return -1
+	case a.Date.After(b.Date):
+		return 1
+	}
+	return 0
+}
+
+// topoOrder compares tags by the length of the first-parent chain
+// from the tagged commit to the root commit.
+func topoOrder(r *git.Repository, tags []ref) (func(a, b ref) int, error) {
+	depths := map[plumbing.Hash]int{}
+	tagDepths := make(map[string]int, len(tags))
+
+	for _, t := range tags {
+		commit, err := r.CommitObject(t.Commit)
+		if err != nil {
+			return nil, fmt.Errorf("get commit for tag %q: %w", t.Name, err)
+		}
+
+		depth, err := firstParentDepth(commit, depths)
+		if err != nil {
+			return nil, fmt.Errorf("walk history for tag %q: %w", t.Name, err)
+		}
+		tagDepths[t.Name] = depth
+	}
+
+	return func(a, b ref) int {
+		return compareInts(tagDepths[a.Name], tagDepths[b.Name])
+	}, nil
+}
+
+// firstParentDepth returns the number of first-parent ancestors of commit.
+// Depths of all visited commits are cached in depths.
+func firstParentDepth(commit *object.Commit, depths map[plumbing.Hash]int) (int, error) {
+	var chain []plumbing.Hash
+	depth := -1
+
+	for {
+		if d, ok := depths[commit.Hash]; ok {
+			depth = d
+			break
+		}
+
+		chain = append(chain, commit.Hash)
+		if commit.NumParents() == 0 {
+			break
+		}
+
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return 0, err
+		}
+		commit = parent
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		depth++
+		depths[chain[i]] = depth
+	}
+
+	return depth, nil
+}
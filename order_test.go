@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortTagsByVersion(t *testing.T) {
+	names := []string{
+		"v1.0.0", "nightly", "v1.0.0-rc.1", "v2.0.0+build.1", "1.10.0", "release-1.9.0",
+		"v1.0.0-alpha", "latest", "v1.0.0+meta", "2.10-v3876", "2.10-v3877", "1.0.0-beta.11", "1.0.0-beta.2",
+	}
+	want := []string{
+		"2.10-v3877", "2.10-v3876", "v2.0.0+build.1", "1.10.0", "release-1.9.0",
+		// equal versions are sorted by name
+		"v1.0.0", "v1.0.0+meta",
+		"v1.0.0-rc.1", "1.0.0-beta.11", "1.0.0-beta.2", "v1.0.0-alpha",
+		// invalid versions go last, sorted by name
+		"latest", "nightly",
+	}
+
+	tags := make([]ref, len(names))
+	for i, name := range names {
+		tags[i] = ref{Name: name, Kind: kindTag}
+	}
+
+	if err := sortTags(nil, tags, tagOptions{Order: orderVersion}); err != nil {
+		t.Fatalf("sortTags() error = %v", err)
+	}
+
+	got := make([]string, len(tags))
+	for i, tag := range tags {
+		got[i] = tag.Name
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortTags() = %q, want %q", got, want)
+	}
+}
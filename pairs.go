@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// Pair strategies, see pairOptions.Strategy.
+const (
+	pairsAll      = "all"      // every ref against every other ref
+	pairsAdjacent = "adjacent" // every ref against the next newer one
+	pairsLatest   = "latest"   // every ref against the newest one
+	pairsPrevious = "previous" // every ref against pairOptions.Previous older ones
+)
+
+// Comparison modes, see pairOptions.Compare.
+const (
+	compareTwoDot   = "two-dot"   // changes between From and To trees
+	compareThreeDot = "three-dot" // changes To introduced since it forked from From
+	compareBoth     = "both"      // both two-dot and three-dot pairs
+)
+
+type pairOptions struct {
+	Strategy string
+	Previous int
+	Compare  string
+}
+
+// pair is a comparison from an older ref to a newer one.
+type pair struct {
+	From ref
+	To   ref
+	Mode string // two-dot or three-dot
+	Base ref    // merge base of From and To, set for three-dot pairs
+}
+
+// Left returns the ref changes are computed from:
+// From for two-dot pairs and the merge base for three-dot ones.
+func (p pair) Left() ref {
+	if p.Mode == compareThreeDot {
+		return p.Base
+	}
+	return p.From
+}
+
+// Page returns the path of the pair files list relative to the output directory:
+// `files/<from>/<to>.html` for two-dot pairs and `merge-base/<from>/<to>.html` for three-dot ones.
+func (p pair) Page() string {
+	dir := "files"
+	if p.Mode == compareThreeDot {
+		dir = "merge-base"
+	}
+	return path.Join(dir, refDir(p.From.Name), refDir(p.To.Name)+".html")
+}
+
+// URL returns the URL of the pair files list relative to the output directory.
+func (p pair) URL() string {
+	return pathURL(p.Page())
+}
+
+// refDir escapes the ref name into a single path segment, so that e.g. "origin/main"
+// doesn't collide with files of "origin": "/" becomes "%2F" and "%" becomes "%25".
+// script.js escapes ref names the same way.
+func refDir(name string) string {
+	return strings.NewReplacer("%", "%25", "/", "%2F").Replace(name)
+}
+
+// pathURL returns the URL of the output path, every segment is escaped,
+// e.g. "files/origin%2Fmain/v1.html" becomes "files/origin%252Fmain/v1.html".
+func pathURL(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// Modes returns comparison modes selected by opts.
+func (opts pairOptions) Modes() []string {
+	switch opts.Compare {
+	case compareThreeDot:
+		return []string{compareThreeDot}
+	case compareBoth:
+		return []string{compareTwoDot, compareThreeDot}
+	}
+	return []string{compareTwoDot}
+}
+
+// getPairs returns pairs of refs to compare.
+// All strategies except "all" compare refs within the same group only,
+// index and worktree pseudo-refs are compared to the newest tags too,
+// refs in groups are expected to be sorted newest first.
+func getPairs(groups []refGroup, opts pairOptions) ([]pair, error) {
+	pairs, err := getRefPairs(groups, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	modes := opts.Modes()
+	result := make([]pair, 0, len(pairs)*len(modes))
+	for _, p := range pairs {
+		for _, mode := range modes {
+			p.Mode = mode
+			result = append(result, p)
+		}
+	}
+
+	return result, nil
+}
+
+func getRefPairs(groups []refGroup, opts pairOptions) ([]pair, error) {
+	var pairs []pair
+
+	if opts.Strategy == pairsAll || opts.Strategy == "" {
+		var refs []ref
+		for _, group := range groups {
+			refs = append(refs, group.Refs...)
+		}
+
+		for _, from := range refs {
+			for _, to := range refs {
+				if from.Name != to.Name {
+					pairs = append(pairs, pair{From: from, To: to})
+				}
+			}
+		}
+		return pairs, nil
+	}
+
+	for _, group := range groups {
+		refs := group.Refs
+
+		switch opts.Strategy {
+		case pairsAdjacent:
+			for i := 0; i+1 < len(refs); i++ {
+				pairs = append(pairs, pair{From: refs[i+1], To: refs[i]})
+			}
+		case pairsLatest:
+			for i := 1; i < len(refs); i++ {
+				pairs = append(pairs, pair{From: refs[i], To: refs[0]})
+			}
+		case pairsPrevious:
+			if opts.Previous < 1 {
+				return nil, fmt.Errorf("number of previous refs should be positive, got %d", opts.Previous)
+			}
+			for i := range refs {
+				for k := 1; k <= opts.Previous && i+k < len(refs); k++ {
+					pairs = append(pairs, pair{From: refs[i+k], To: refs[i]})
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown pairs strategy %q", opts.Strategy)
+		}
+	}
+
+	localPairs, err := getLocalPairs(groups, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(pairs, localPairs...), nil
+}
+
+// getLocalPairs pairs index and worktree pseudo-refs with the newest tag,
+// or with the newest opts.Previous ones for the "previous" strategy,
+// as local changes are compared to releases they would follow.
+func getLocalPairs(groups []refGroup, opts pairOptions) ([]pair, error) {
+	var tags, local []ref
+	for _, group := range groups {
+		for _, rf := range group.Refs {
+			switch rf.Kind {
+			case kindTag:
+				tags = append(tags, rf)
+			case kindIndex, kindWorktree:
+				local = append(local, rf)
+			}
+		}
+	}
+	if len(local) == 0 {
+		return nil, nil
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no tags to compare %s against with %q pairs strategy, use %q strategy", local[0].Name, opts.Strategy, pairsAll)
+	}
+
+	n := 1
+	if opts.Strategy == pairsPrevious {
+		n = opts.Previous
+	}
+
+	var pairs []pair
+	for _, rf := range local {
+		for k := 0; k < n && k < len(tags); k++ {
+			pairs = append(pairs, pair{From: tags[k], To: rf})
+		}
+	}
+	return pairs, nil
+}
+
+// resolveMergeBases sets Base for three-dot pairs.
+// Pairs without a merge base (unrelated histories) are skipped.
+// It also returns merge bases that are not among refs, named by their short hashes.
+func resolveMergeBases(r *git.Repository, pairs []pair, refs []ref) ([]pair, []ref, error) {
+	byCommit := map[string]ref{}
+	for _, rf := range refs {
+		// index and worktree point to HEAD, but their trees are not the HEAD tree
+		if rf.Kind == kindIndex || rf.Kind == kindWorktree {
+			continue
+		}
+		if _, ok := byCommit[rf.Commit.String()]; !ok {
+			byCommit[rf.Commit.String()] = rf
+		}
+	}
+
+	var bases []ref
+	result := pairs[:0]
+	for _, p := range pairs {
+		if p.Mode != compareThreeDot {
+			result = append(result, p)
+			continue
+		}
+
+		from, err := r.CommitObject(p.From.Commit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get commit for %q: %w", p.From.Name, err)
+		}
+		to, err := r.CommitObject(p.To.Commit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get commit for %q: %w", p.To.Name, err)
+		}
+
+		commits, err := from.MergeBase(to)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get merge base of %q and %q: %w", p.From.Name, p.To.Name, err)
+		}
+		if len(commits) == 0 {
+			log.Printf("Skipping %s...%s: no merge base", p.From.Name, p.To.Name)
+			continue
+		}
+
+		base, ok := byCommit[commits[0].Hash.String()]
+		if !ok {
+			base, err = newRef(r, kindMergeBase, commits[0].Hash.String()[:7], commits[0].Hash)
+			if err != nil {
+				return nil, nil, fmt.Errorf("read merge base %s: %w", commits[0].Hash, err)
+			}
+			byCommit[base.Commit.String()] = base
+			bases = append(bases, base)
+		}
+
+		p.Base = base
+		result = append(result, p)
+	}
+
+	return result, bases, nil
+}
+
+// pairsMap returns names of refs each ref is compared to, keyed by its name.
+func pairsMap(pairs []pair) map[string][]string {
+	m := map[string][]string{}
+	seen := map[string]bool{}
+	for _, p := range pairs {
+		key := p.From.Name + "\x00" + p.To.Name
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		m[p.From.Name] = append(m[p.From.Name], p.To.Name)
+	}
+	return m
+}
+
+// modePairs returns pairs compared in the mode.
+func modePairs(pairs []pair, mode string) []pair {
+	var result []pair
+	for _, p := range pairs {
+		if p.Mode == mode {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// mergeBasesMap returns names of merge bases of three-dot pairs, keyed by From and To names.
+func mergeBasesMap(pairs []pair) map[string]map[string]string {
+	m := map[string]map[string]string{}
+	for _, p := range pairs {
+		if p.Mode != compareThreeDot {
+			continue
+		}
+		if m[p.From.Name] == nil {
+			m[p.From.Name] = map[string]string{}
+		}
+		m[p.From.Name][p.To.Name] = p.Base.Name
+	}
+	return m
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// patchSet is a diff.Patch of selected file patches.
+type patchSet struct {
+	message  string
+	patches  []diff.FilePatch
+	matchers []funcnameMatcher // funcname patterns of every patch, for hunk header contexts
+}
+
+func (p patchSet) Message() string {
+	return p.message
+}
+
+func (p patchSet) FilePatches() []diff.FilePatch {
+	return p.patches
+}
+
+// patchPath returns the path of the pair patch relative to the output directory.
+func patchPath(from, to string) string {
+	return path.Join("patches", refDir(from), refDir(to)+".patch")
+}
+
+// fileDiffPath returns the path of the file diff relative to the output directory.
+func fileDiffPath(from, to, name string) string {
+	return path.Join("patches", refDir(from), refDir(to), name+".diff")
+}
+
+// writePatches writes a unified diff of all changes between refs into
+// `patches/<from>/<to>.patch` and of every changed file into
+// `patches/<from>/<to>/<file>.diff`, both can be applied with `git apply`.
+func (g *generator) writePatches(from, to ref, changes []file) error {
+	patches := make([]diff.FilePatch, 0, len(changes))
+	matchers := make([]funcnameMatcher, 0, len(changes))
+	for _, f := range changes {
+		if f.WhitespaceOnly && f.OldMode == f.Mode {
+			continue
+		}
+
+		name := f.Name
+		if f.Operation == "D" {
+			name = f.OldName
+		}
+
+		var filePatches []diff.FilePatch
+		if f.WhitespaceOnly {
+			filePatches = []diff.FilePatch{modeFilePatch(f.change)}
+		} else if f.Operation == "T" {
+			split, err := g.splitTypeChange(f.change)
+			if err != nil {
+				return fmt.Errorf("split type change of %s: %w", name, err)
+			}
+			filePatches = split
+		} else {
+			rawPatch, err := g.rawPatch(f)
+			if err != nil {
+				return fmt.Errorf("get patch for %s: %w", name, err)
+			}
+			filePatches = []diff.FilePatch{rawPatch}
+		}
+
+		fileMatchers := make([]funcnameMatcher, len(filePatches))
+		for i := range fileMatchers {
+			fileMatchers[i] = newFuncnameMatcher(g.diffOptions.Funcname, name)
+		}
+
+		if err := writePatch(fileDiffPath(from.Name, to.Name, name), patchSet{patches: filePatches, matchers: fileMatchers}); err != nil {
+			return fmt.Errorf("write diff for %s: %w", name, err)
+		}
+		patches = append(patches, filePatches...)
+		matchers = append(matchers, fileMatchers...)
+	}
+
+	message := fmt.Sprintf("Changes from %s to %s\n", from.Name, to.Name)
+	if err := writePatch(patchPath(from.Name, to.Name), patchSet{message: message, patches: patches, matchers: matchers}); err != nil {
+		return fmt.Errorf("write patch: %w", err)
+	}
+
+	return nil
+}
+
+// rawPatch returns the patch of raw blobs of the file. Patches of too large files
+// are not kept in memory, they are computed once more to be written, as limits
+// only guard rendered pages.
+func (g *generator) rawPatch(f file) (diff.FilePatch, error) {
+	if f.TooLarge == "" {
+		return f.rawPatch, nil
+	}
+
+	var patch diff.FilePatch
+	if isSubmoduleChange(f.change) {
+		p, err := g.submodulePatch(f.change)
+		if err != nil {
+			return nil, err
+		}
+		patch = p
+	} else {
+		p, err := f.change.Patch()
+		if err != nil {
+			return nil, err
+		}
+		filePatches := p.FilePatches()
+		if len(filePatches) == 0 {
+			return nil, fmt.Errorf("no patch for %s", f.change)
+		}
+		patch = filePatches[0]
+	}
+
+	if g.diffOptions.Whitespace != "" && !patch.IsBinary() {
+		patch = ignoreWhitespace(patch, g.diffOptions.Whitespace)
+	}
+
+	return patch, nil
+}
+
+// binaryFilePatch is a patch of a binary file, encoded as "Binary files differ".
+type binaryFilePatch struct {
+	from, to diff.File
+}
+
+func (p binaryFilePatch) IsBinary() bool {
+	return true
+}
+
+func (p binaryFilePatch) Files() (from, to diff.File) {
+	return p.from, p.to
+}
+
+func (p binaryFilePatch) Chunks() []diff.Chunk {
+	return nil
+}
+
+// modeFilePatch returns a patch of the file mode only, for files which contents
+// changed in ignored whitespace. Both sides get the new blob hash, so the encoder
+// writes "old mode" and "new mode" lines without an index line and hunks.
+func modeFilePatch(change *object.Change) diff.FilePatch {
+	from := entryFile{path: change.From.Name, hash: change.To.TreeEntry.Hash, mode: change.From.TreeEntry.Mode}
+	to := entryFile{path: change.To.Name, hash: change.To.TreeEntry.Hash, mode: change.To.TreeEntry.Mode}
+	return modePatch{from: from, to: to}
+}
+
+// modePatch is a patch without hunks.
+type modePatch struct {
+	from, to diff.File
+}
+
+func (p modePatch) IsBinary() bool {
+	return false
+}
+
+func (p modePatch) Files() (from, to diff.File) {
+	return p.from, p.to
+}
+
+func (p modePatch) Chunks() []diff.Chunk {
+	return nil
+}
+
+// splitTypeChange splits the change of a file which type changed into a deletion
+// of the old entry and an addition of the new one, as git can't apply a type change
+// in place. Sides are read from raw blobs, submodules are "Subproject commit" lines.
+func (g *generator) splitTypeChange(change *object.Change) ([]diff.FilePatch, error) {
+	var patches []diff.FilePatch
+
+	for i, entry := range []object.ChangeEntry{change.From, change.To} {
+		f := entryFile{path: entry.Name, hash: entry.TreeEntry.Hash, mode: entry.TreeEntry.Mode}
+		deleted := i == 0
+
+		var content string
+		if entry.TreeEntry.Mode == filemode.Submodule {
+			content = fmt.Sprintf("Subproject commit %s\n", entry.TreeEntry.Hash)
+		} else {
+			blob, err := g.readBlob(entry.TreeEntry.Hash, -1)
+			if err != nil {
+				return nil, err
+			}
+			if isBinary(blob) {
+				if deleted {
+					patches = append(patches, binaryFilePatch{from: f})
+				} else {
+					patches = append(patches, binaryFilePatch{to: f})
+				}
+				continue
+			}
+			content = string(blob)
+		}
+
+		if deleted {
+			patches = append(patches, lineDiff(f, nil, content, "", ""))
+		} else {
+			patches = append(patches, lineDiff(nil, f, "", content, ""))
+		}
+	}
+
+	return patches, nil
+}
+
+func writePatch(name string, p patchSet) error {
+	filePath := filepath.Join("output", filepath.FromSlash(name))
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(filePath), err)
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	if err := diff.NewUnifiedEncoder(&buf, diff.DefaultContextLines).Encode(p); err != nil {
+		return fmt.Errorf("encode %s: %w", filePath, err)
+	}
+
+	if _, err := f.Write(setHeaderFunctions(buf.Bytes(), p)); err != nil {
+		return fmt.Errorf("write %s: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// hunkHeaderRegexp matches hunk headers written by diff.UnifiedEncoder,
+// the first group is the header without a context, the second is the old start.
+var hunkHeaderRegexp = regexp.MustCompile(`^(@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@)`)
+
+// setHeaderFunctions replaces contexts of hunk headers of the encoded patch, which
+// diff.UnifiedEncoder sets to the line above the hunk, with the nearest function line
+// above it, like setHunkFunctions does for pages. Files without funcname patterns are kept.
+func setHeaderFunctions(encoded []byte, p patchSet) []byte {
+	var (
+		out       bytes.Buffer
+		index     = -1 // of the current file patch
+		enclosing []string
+	)
+
+	for _, line := range bytes.SplitAfter(encoded, []byte("\n")) {
+		switch {
+		case bytes.HasPrefix(line, []byte("diff --git ")):
+			index++
+			enclosing = nil
+			if index < len(p.matchers) && len(p.matchers[index]) > 0 && !p.patches[index].IsBinary() {
+				oldContent, _ := patchContents(p.patches[index])
+				enclosing = p.matchers[index].enclosing(splitLinesKeepEOL(oldContent))
+			}
+		case enclosing != nil:
+			groups := hunkHeaderRegexp.FindSubmatch(line)
+			if groups == nil {
+				break
+			}
+			out.Write(groups[1])
+			// the line right above the hunk
+			if start, _ := strconv.Atoi(string(groups[2])); start > 1 && start-2 < len(enclosing) && enclosing[start-2] != "" {
+				out.WriteString(" " + enclosing[start-2])
+			}
+			out.WriteString("\n")
+			continue
+		}
+		out.Write(line)
+	}
+
+	return out.Bytes()
+}
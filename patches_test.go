@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+func TestSetHeaderFunctions(t *testing.T) {
+	oldContent := "package main\n\nfunc a() {\n\t1\n\t2\n\t3\n\t4\n\t5\n\t6\n\t7\n}\n\nfunc b() {\n\t8\n\t9\n\t10\n\t11\n\t12\n}\n"
+	newContent := "package main\n\nfunc a() {\n\t1\n\t2\n\t3\n\t4\n\t5\n\tsix\n\t7\n}\n\nfunc b() {\n\t8\n\t9\n\t10\n\t11\n\ttwelve\n}\n"
+
+	var patches []diff.FilePatch
+	var matchers []funcnameMatcher
+	for _, name := range []string{"a.go", "a.txt"} {
+		from := entryFile{path: name, hash: plumbing.NewHash("1"), mode: filemode.Regular}
+		to := entryFile{path: name, hash: plumbing.NewHash("2"), mode: filemode.Regular}
+		patches = append(patches, lineDiff(from, to, oldContent, newContent, ""))
+		matchers = append(matchers, newFuncnameMatcher(nil, name))
+	}
+	p := patchSet{patches: patches, matchers: matchers}
+
+	var buf bytes.Buffer
+	if err := diff.NewUnifiedEncoder(&buf, diff.DefaultContextLines).Encode(p); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	var got []string
+	for _, line := range strings.Split(string(setHeaderFunctions(buf.Bytes(), p)), "\n") {
+		if strings.HasPrefix(line, "@@ ") {
+			got = append(got, line)
+		}
+	}
+
+	want := []string{
+		"@@ -6,7 +6,7 @@ func a() {",
+		"@@ -15,5 +15,5 @@ func b() {",
+		// files without funcname patterns keep the line above the hunk
+		"@@ -6,7 +6,7 @@ \t2",
+		"@@ -15,5 +15,5 @@ \t8",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("setHeaderFunctions() hunk headers =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
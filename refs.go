@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Ref kinds, see ref.Kind.
+const (
+	kindTag    = "tag"
+	kindBranch = "branch"
+	kindRemote = "remote"
+	kindRef    = "ref"
+	kindCommit = "commit"
+
+	kindIndex     = "index"      // staging index, see getLocalRefs
+	kindWorktree  = "worktree"   // working tree, see getLocalRefs
+	kindMergeBase = "merge-base" // merge base of a three-dot pair, not selectable
+)
+
+// ref is a point in the repository history that can be compared.
+type ref struct {
+	Name      string
+	Kind      string        // tag, branch, remote, ref, commit, index, worktree or merge-base
+	Hash      plumbing.Hash // hash the reference points to
+	Commit    plumbing.Hash // hash of the commit, annotated tags are peeled down to it, HEAD for index and worktree
+	Tree      plumbing.Hash // hash of the root tree
+	Annotated bool
+
+	// for everything except annotated tags Tagger, Date and Message are taken from the commit
+	Tagger  object.Signature
+	Date    time.Time
+	Message string
+}
+
+// Subject returns the first line of the message.
+func (r ref) Subject() string {
+	subject, _, _ := strings.Cut(r.Message, "\n")
+	return strings.TrimSpace(subject)
+}
+
+type refGroup struct {
+	Label string
+	Refs  []ref
+}
+
+type refOptions struct {
+	Tags     tagOptions
+	Branches bool     // include local branches
+	Remotes  bool     // include remote-tracking branches
+	Refs     []string // explicit references or revisions, e.g. "refs/pull/1/head" or "main~10"
+
+	Commits      string    // revision to walk first-parent history from, e.g. "main"
+	CommitsLimit int       // maximum number of commits, 0 means no limit
+	CommitsSince time.Time // skip commits older than this date, zero means no limit
+
+	Index    bool // include the staging index
+	Worktree bool // include the working tree
+}
+
+// getRefs returns refs selected by opts grouped by kind.
+// Refs which names are already taken by a previous group are skipped.
+// Trees of index and worktree pseudo-refs are stored in s.
+func getRefs(r *git.Repository, s storer.EncodedObjectStorer, opts refOptions) ([]refGroup, error) {
+	var groups []refGroup
+
+	tags, err := getTags(r, opts.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("get tags: %w", err)
+	}
+	groups = append(groups, refGroup{Label: "Tags", Refs: tags})
+
+	if opts.Branches {
+		branches, err := getBranches(r, kindBranch, plumbing.ReferenceName.IsBranch)
+		if err != nil {
+			return nil, fmt.Errorf("get branches: %w", err)
+		}
+		groups = append(groups, refGroup{Label: "Branches", Refs: branches})
+	}
+
+	if opts.Remotes {
+		remotes, err := getBranches(r, kindRemote, plumbing.ReferenceName.IsRemote)
+		if err != nil {
+			return nil, fmt.Errorf("get remote branches: %w", err)
+		}
+		groups = append(groups, refGroup{Label: "Remote branches", Refs: remotes})
+	}
+
+	if len(opts.Refs) > 0 {
+		refs, err := getExplicitRefs(r, opts.Refs)
+		if err != nil {
+			return nil, fmt.Errorf("get refs: %w", err)
+		}
+		groups = append(groups, refGroup{Label: "Refs", Refs: refs})
+	}
+
+	if opts.Commits != "" {
+		commits, err := getCommits(r, opts.Commits, opts.CommitsLimit, opts.CommitsSince)
+		if err != nil {
+			return nil, fmt.Errorf("get commits: %w", err)
+		}
+		groups = append(groups, refGroup{Label: "Commits on " + opts.Commits, Refs: commits})
+	}
+
+	if opts.Index || opts.Worktree {
+		local, err := getLocalRefs(r, s, opts.Index, opts.Worktree)
+		if err != nil {
+			return nil, fmt.Errorf("get local changes: %w", err)
+		}
+		groups = append(groups, refGroup{Label: "Local changes", Refs: local})
+	}
+
+	names := map[string]bool{}
+	result := groups[:0]
+	for _, group := range groups {
+		refs := group.Refs[:0]
+		for _, rf := range group.Refs {
+			if names[rf.Name] {
+				log.Printf("Skipping %s %q: name is already taken", rf.Kind, rf.Name)
+				continue
+			}
+			names[rf.Name] = true
+			refs = append(refs, rf)
+		}
+		if len(refs) == 0 {
+			continue
+		}
+		group.Refs = refs
+		result = append(result, group)
+	}
+
+	return result, nil
+}
+
+func getTags(r *git.Repository, opts tagOptions) ([]ref, error) {
+	var tags []ref
+
+	refs, err := r.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("get tags: %w", err)
+	}
+
+	err = refs.ForEach(func(reference *plumbing.Reference) error {
+		name := reference.Name().Short()
+		if skipTag(name, opts) {
+			return nil
+		}
+
+		t, err := newRef(r, kindTag, name, reference.Hash())
+		if err == errNotCommit {
+			log.Printf("Skipping tag %q: %v", name, err)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tag %q: %w", name, err)
+		}
+		tags = append(tags, t)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("iterate tags: %w", err)
+	}
+
+	if err := sortTags(r, tags, opts); err != nil {
+		return nil, fmt.Errorf("sort tags: %w", err)
+	}
+
+	if opts.Last > 0 && len(tags) > opts.Last {
+		tags = tags[:opts.Last]
+	}
+
+	return tags, nil
+}
+
+func skipTag(name string, opts tagOptions) bool {
+	if len(opts.Include) > 0 && !matchAny(opts.Include, name) {
+		return true
+	}
+	if matchAny(opts.Exclude, name) {
+		return true
+	}
+	if opts.NoPrereleases && len(parseVersion(name).prerelease) > 0 {
+		return true
+	}
+	return false
+}
+
+// getBranches returns branches which names match filter, most recently updated first.
+func getBranches(r *git.Repository, kind string, filter func(plumbing.ReferenceName) bool) ([]ref, error) {
+	var branches []ref
+
+	refs, err := r.References()
+	if err != nil {
+		return nil, fmt.Errorf("get references: %w", err)
+	}
+
+	err = refs.ForEach(func(reference *plumbing.Reference) error {
+		// skip symbolic references like "origin/HEAD"
+		if reference.Type() != plumbing.HashReference || !filter(reference.Name()) {
+			return nil
+		}
+
+		b, err := newRef(r, kind, reference.Name().Short(), reference.Hash())
+		if err != nil {
+			return fmt.Errorf("read %s %q: %w", kind, reference.Name().Short(), err)
+		}
+		branches = append(branches, b)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("iterate references: %w", err)
+	}
+
+	sortRefs(branches, dateOrder)
+
+	return branches, nil
+}
+
+func getExplicitRefs(r *git.Repository, specs []string) ([]ref, error) {
+	refs := make([]ref, 0, len(specs))
+
+	for _, spec := range specs {
+		hash, err := r.ResolveRevision(plumbing.Revision(spec))
+		if err != nil {
+			return nil, fmt.Errorf("resolve %q: %w", spec, err)
+		}
+
+		rf, err := newRef(r, kindRef, spec, *hash)
+		if err != nil {
+			return nil, fmt.Errorf("read %q: %w", spec, err)
+		}
+		refs = append(refs, rf)
+	}
+
+	return refs, nil
+}
+
+// getCommits returns commits along the first-parent history of rev, newest first.
+// Commits are named by their short hashes.
+func getCommits(r *git.Repository, rev string, limit int, since time.Time) ([]ref, error) {
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", rev, err)
+	}
+
+	commit, err := r.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("get commit %s: %w", hash, err)
+	}
+
+	var commits []ref
+	for {
+		if limit > 0 && len(commits) >= limit {
+			break
+		}
+		if !since.IsZero() && commit.Author.When.Before(since) {
+			break
+		}
+
+		commits = append(commits, ref{
+			Name:    commit.Hash.String()[:7],
+			Kind:    kindCommit,
+			Hash:    commit.Hash,
+			Commit:  commit.Hash,
+			Tree:    commit.TreeHash,
+			Tagger:  commit.Author,
+			Date:    commit.Author.When,
+			Message: strings.TrimSpace(commit.Message),
+		})
+
+		if commit.NumParents() == 0 {
+			break
+		}
+
+		commit, err = commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("get parent of %s: %w", commits[len(commits)-1].Name, err)
+		}
+	}
+
+	return commits, nil
+}
+
+var errNotCommit = errors.New("reference does not point to a commit")
+
+// newRef reads ref metadata, peeling annotated tags down to the commit.
+func newRef(r *git.Repository, kind, name string, hash plumbing.Hash) (ref, error) {
+	result := ref{
+		Name: name,
+		Kind: kind,
+		Hash: hash,
+	}
+
+	for {
+		obj, err := r.TagObject(hash)
+		if err == plumbing.ErrObjectNotFound {
+			break // not a tag object, expect a commit
+		}
+		if err != nil {
+			return ref{}, fmt.Errorf("get tag object %s: %w", hash, err)
+		}
+
+		if !result.Annotated {
+			result.Annotated = true
+			result.Tagger = obj.Tagger
+			result.Date = obj.Tagger.When
+			result.Message = strings.TrimSpace(obj.Message)
+		}
+
+		switch obj.TargetType {
+		case plumbing.TagObject, plumbing.CommitObject:
+			hash = obj.Target
+		default:
+			return ref{}, errNotCommit
+		}
+	}
+
+	commit, err := r.CommitObject(hash)
+	if err == plumbing.ErrObjectNotFound {
+		return ref{}, errNotCommit
+	}
+	if err != nil {
+		return ref{}, fmt.Errorf("get commit %s: %w", hash, err)
+	}
+
+	result.Commit = commit.Hash
+	result.Tree = commit.TreeHash
+	if !result.Annotated {
+		result.Tagger = commit.Author
+		result.Date = commit.Author.When
+		result.Message = strings.TrimSpace(commit.Message)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// similarityIndex counts bytes per hashed region of a file, where a region
+// is a line of a text file or a block of up to 64 bytes, like git does
+// for rename detection.
+type similarityIndex struct {
+	hashed uint64
+	counts map[uint32]uint64
+}
+
+func newSimilarityIndex(content []byte, binary bool) similarityIndex {
+	idx := similarityIndex{counts: map[uint32]uint64{}}
+
+	for i := 0; i < len(content); {
+		var (
+			hash uint32 = 5381
+			cnt  uint64
+			n    int
+		)
+
+		for i < len(content) {
+			c := content[i]
+			i++
+			n++
+
+			// ignore CR in CRLF sequence if it's text
+			if !binary && c == '\r' && i < len(content) && content[i] == '\n' {
+				continue
+			}
+			cnt++
+
+			if c == '\n' {
+				break
+			}
+			hash = (hash << 5) + hash + uint32(c)
+
+			if n >= 64 {
+				break
+			}
+		}
+
+		idx.hashed += cnt
+		idx.counts[hash] += cnt
+	}
+
+	return idx
+}
+
+func fileSimilarityIndex(f *object.File) (similarityIndex, error) {
+	binary, err := f.IsBinary()
+	if err != nil {
+		return similarityIndex{}, err
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return similarityIndex{}, err
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return similarityIndex{}, err
+	}
+
+	return newSimilarityIndex(content, binary), nil
+}
+
+// score returns similarity of two files in percent: the number of bytes
+// in common regions divided by the number of bytes in the larger file.
+func (idx similarityIndex) score(other similarityIndex) int {
+	larger := idx.hashed
+	if other.hashed > larger {
+		larger = other.hashed
+	}
+	if larger == 0 {
+		return 100
+	}
+
+	var common uint64
+	for hash, cnt := range idx.counts {
+		if otherCnt := other.counts[hash]; otherCnt < cnt {
+			common += otherCnt
+		} else {
+			common += cnt
+		}
+	}
+
+	return int(common * 100 / larger)
+}
+
+func fileSimilarity(a, b *object.File) (int, error) {
+	if a.Hash == b.Hash {
+		return 100, nil
+	}
+
+	idxA, err := fileSimilarityIndex(a)
+	if err != nil {
+		return 0, fmt.Errorf("index %s: %w", a.Name, err)
+	}
+
+	idxB, err := fileSimilarityIndex(b)
+	if err != nil {
+		return 0, fmt.Errorf("index %s: %w", b.Name, err)
+	}
+
+	return idxA.score(idxB), nil
+}
+
+// copySource is a file in the source tree an added file was copied from.
+type copySource struct {
+	Name       string
+	Similarity int
+}
+
+// detectCopies finds added files that are copies of files in the source tree.
+// Only sources of modified files are considered, unless harder is true,
+// then all files of the source tree are. Exact copies are always detected,
+// similar ones only if the number of added files and sources is within opts.RenameLimit.
+func detectCopies(tree *object.Tree, changes object.Changes, opts *object.DiffTreeOptions, harder bool) (map[*object.Change]copySource, error) {
+	var added []*object.Change
+	var sources []*object.File
+
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, fmt.Errorf("get action: %w", err)
+		}
+
+		switch action {
+		case merkletrie.Insert:
+			added = append(added, change)
+		case merkletrie.Modify:
+			if !harder && change.From.Name == change.To.Name && change.From.TreeEntry.Mode.IsFile() {
+				f, err := tree.TreeEntryFile(&change.From.TreeEntry)
+				if err != nil {
+					return nil, fmt.Errorf("get file %s: %w", change.From.Name, err)
+				}
+				f.Name = change.From.Name
+				sources = append(sources, f)
+			}
+		}
+	}
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	if harder {
+		err := tree.Files().ForEach(func(f *object.File) error {
+			sources = append(sources, f)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("iterate files: %w", err)
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Name < sources[j].Name
+	})
+
+	byHash := map[plumbing.Hash]string{}
+	for _, f := range sources {
+		if _, ok := byHash[f.Hash]; !ok {
+			byHash[f.Hash] = f.Name
+		}
+	}
+
+	inexact := !opts.OnlyExactRenames && (opts.RenameLimit == 0 ||
+		(uint(len(added)) <= opts.RenameLimit && uint(len(sources)) <= opts.RenameLimit))
+
+	indexes := map[string]similarityIndex{}
+	copies := map[*object.Change]copySource{}
+
+	for _, change := range added {
+		if !change.To.TreeEntry.Mode.IsFile() {
+			continue
+		}
+
+		if name, ok := byHash[change.To.TreeEntry.Hash]; ok {
+			copies[change] = copySource{Name: name, Similarity: 100}
+			continue
+		}
+
+		if !inexact {
+			continue
+		}
+
+		_, to, err := change.Files()
+		if err != nil {
+			return nil, fmt.Errorf("get files for %s: %w", change.To.Name, err)
+		}
+
+		toIdx, err := fileSimilarityIndex(to)
+		if err != nil {
+			return nil, fmt.Errorf("index %s: %w", change.To.Name, err)
+		}
+
+		best := copySource{}
+		for _, src := range sources {
+			idx, ok := indexes[src.Name]
+			if !ok {
+				idx, err = fileSimilarityIndex(src)
+				if err != nil {
+					return nil, fmt.Errorf("index %s: %w", src.Name, err)
+				}
+				indexes[src.Name] = idx
+			}
+
+			if score := idx.score(toIdx); score > best.Similarity {
+				best = copySource{Name: src.Name, Similarity: score}
+			}
+		}
+
+		if best.Name != "" && best.Similarity >= int(opts.RenameScore) {
+			copies[change] = best
+		}
+	}
+
+	return copies, nil
+}
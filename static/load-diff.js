@@ -6,14 +6,25 @@ function load(e) {
     if (selected) {
         selected.classList.remove('selected');
     }
-    e.target.classList.add('selected');
+    e.currentTarget.classList.add('selected');
 
     window.parent.document.dispatchEvent(new CustomEvent('loadDiff', {
         detail: {
-            tag1: e.target.dataset.tag1,
-            tag2: e.target.dataset.tag2,
-            file: e.target.dataset.name,
-            oldFile: e.target.dataset.oldname
+            tag1: e.currentTarget.dataset.tag1,
+            tag2: e.currentTarget.dataset.tag2,
+            file: e.currentTarget.dataset.name,
+            oldFile: e.currentTarget.dataset.oldname,
+            binary: e.currentTarget.dataset.binary ? {
+                tooLarge: e.currentTarget.dataset.toolarge,
+                oldHash: e.currentTarget.dataset.oldhash,
+                oldSize: Number(e.currentTarget.dataset.oldsize),
+                hash: e.currentTarget.dataset.hash,
+                size: Number(e.currentTarget.dataset.size)
+            } : null,
+            submodule: e.currentTarget.dataset.oldcommit !== undefined ? {
+                oldCommit: e.currentTarget.dataset.oldcommit,
+                commit: e.currentTarget.dataset.commit
+            } : null
         }
     }));
 }
@@ -34,23 +34,245 @@ function xhr(url) {
     );
 }
 
+// disable refs which were not compared,
+// `pairs`, `manifests` and `filesPages` are defined in index.html
+function updatePairs() {
+    if (manifests) {
+        // changes between any refs can be computed from manifests
+        return;
+    }
+
+    var from = document.querySelector('select[name="from"]');
+    from.querySelectorAll('option').forEach(function (option) {
+        option.disabled = !pairs[option.value];
+    });
+    if (from.selectedOptions.length == 0 || from.selectedOptions[0].disabled) {
+        selectFirstEnabled(from);
+    }
+
+    var to = document.querySelector('select[name="to"]');
+    var targets = pairs[from.value] || [];
+    to.querySelectorAll('option').forEach(function (option) {
+        option.disabled = targets.indexOf(option.value) == -1;
+    });
+    if (to.selectedOptions.length == 0 || to.selectedOptions[0].disabled) {
+        selectFirstEnabled(to);
+    }
+}
+
+function selectFirstEnabled(select) {
+    var option = select.querySelector('option:not([disabled])');
+    if (option) {
+        select.value = option.value;
+    }
+}
+
+// refURL escapes the ref name into a single path segment like refDir in pairs.go does,
+// e.g. "origin/main" is written to "origin%2Fmain", and escapes the segment for URLs
+function refURL(name) {
+    return encodeURIComponent(name.replace(/%/g, '%25').replace(/\//g, '%2F'));
+}
+
+// contentURL returns the URL of the file copied to content/<ref>/
+function contentURL(tag, file) {
+    return './content/' + refURL(tag) + '/' + file.split('/').map(encodeURIComponent).join('/');
+}
+
 function loadFiles() {
     var from = document.querySelector('select[name="from"]').value;
     var to = document.querySelector('select[name="to"]').value;
     var files = document.getElementById('files');
-    files.src = './files/' + from + '/' + to + '.html';
+
+    var modeSelect = document.querySelector('select[name="mode"]');
+    var mode = modeSelect ? modeSelect.value : modes[0];
+
+    // three-dot pairs without a merge base are skipped even if their two-dot side is rendered,
+    // `mergeBases` are defined in index.html
+    var base = (mergeBases[from] || {})[to];
+    if (mode == 'three-dot' && !base) {
+        files.srcdoc = '<link rel="stylesheet" href="style.css"><p class="no-changes">Merge base is unknown</p>';
+        return;
+    }
+
+    var rendered = filesPages && (pairs[from] || []).indexOf(to) != -1;
+    if (!rendered && manifests) {
+        // three-dot changes are computed from the merge base
+        loadManifestFiles(mode == 'three-dot' ? base : from, to);
+        return;
+    }
+
+    var dir = mode == 'three-dot' ? './merge-base/' : './files/';
+    files.removeAttribute('srcdoc');
+    files.src = dir + refURL(from) + '/' + refURL(to) + '.html';
+}
+
+function loadManifestFiles(from, to) {
+    Promise.all([xhr('./manifests/' + refURL(from) + '.json'), xhr('./manifests/' + refURL(to) + '.json')]).then(function (r) {
+        var changes = diffManifests(JSON.parse(r[0].responseText), JSON.parse(r[1].responseText));
+        document.getElementById('files').srcdoc = renderFiles(from, to, changes);
+    });
+}
+
+// diffManifests returns changes between two manifests,
+// each manifest is a map of file path to [hash, mode, size, binary].
+// Files deleted and added with the same hash are reported as renamed.
+function diffManifests(from, to) {
+    var changes = [];
+    var deleted = {}; // hash -> paths
+
+    Object.keys(from).forEach(function (name) {
+        if (!(name in to)) {
+            var hash = from[name][0];
+            (deleted[hash] = deleted[hash] || []).push(name);
+        } else if (entryType(from[name][1]) != entryType(to[name][1])) {
+            changes.push({ operation: 'T', name: name, oldName: name, binary: binaryInfo(from[name], to[name]) });
+        } else if (from[name][0] != to[name][0]) {
+            changes.push({ operation: 'M', name: name, oldName: name, binary: binaryInfo(from[name], to[name]) });
+        } else if (from[name][1] != to[name][1]) {
+            changes.push({ operation: 'X', name: name, oldName: name, binary: binaryInfo(from[name], to[name]) });
+        }
+    });
+
+    Object.keys(to).forEach(function (name) {
+        if (name in from) {
+            return;
+        }
+        var olds = deleted[to[name][0]];
+        if (olds && olds.length > 0) {
+            var oldName = olds.shift();
+            changes.push({ operation: 'R', name: name, oldName: oldName, binary: binaryInfo(from[oldName], to[name]) });
+        } else {
+            changes.push({ operation: 'A', name: name, oldName: '', binary: binaryInfo(null, to[name]) });
+        }
+    });
+
+    Object.keys(deleted).forEach(function (hash) {
+        deleted[hash].forEach(function (name) {
+            changes.push({ operation: 'D', name: '', oldName: name, binary: binaryInfo(from[name], null) });
+        });
+    });
+
+    changes.sort(function (a, b) {
+        var x = a.name || a.oldName, y = b.name || b.oldName;
+        return x < y ? -1 : x > y ? 1 : 0;
+    });
+
+    return changes;
+}
+
+// entryType returns the type of the tree entry by its mode, like modes.go does
+function entryType(mode) {
+    switch (Number.parseInt(mode, 8)) {
+    case 0o120000:
+        return 'symlink';
+    case 0o160000:
+        return 'submodule';
+    }
+    return 'file';
+}
+
+// binaryInfo returns hashes and sizes of manifest entries if any of them is binary, null otherwise
+function binaryInfo(from, to) {
+    if (!(from && from[3]) && !(to && to[3])) {
+        return null;
+    }
+    return {
+        oldHash: from ? from[0] : '',
+        oldSize: from ? from[2] : 0,
+        hash: to ? to[0] : '',
+        size: to ? to[2] : 0
+    };
+}
+
+function escapeHTML(s) {
+    return s.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;');
+}
+
+// renderFiles returns files list document, same as files.gohtml renders
+function renderFiles(from, to, changes) {
+    var html = '<!doctype html><html lang="en"><head><meta charset="utf-8">' +
+        '<link rel="stylesheet" href="style.css"><script src="load-diff.js"></script></head><body>';
+
+    if (changes.length == 0) {
+        html += '<p class="no-changes">No changes</p>';
+    }
+
+    var classes = { A: 'new', D: 'deleted', M: 'modified', R: 'renamed', T: 'modified type-changed', X: 'modified mode-changed' };
+    changes.forEach(function (c) {
+        var name = c.operation == 'D' ? c.oldName : c.name;
+        var title = c.operation == 'R' ? c.oldName + ' → ' + c.name : name;
+        var b = c.binary;
+        html += '<a class="file ' + classes[c.operation] + (b ? ' binary' : '') + '" onclick="load(event)"' +
+            (b ? ' data-binary="true" data-oldhash="' + b.oldHash + '" data-oldsize="' + b.oldSize + '"' +
+                ' data-hash="' + b.hash + '" data-size="' + b.size + '"' : '') +
+            ' data-tag1="' + escapeHTML(from) + '" data-tag2="' + escapeHTML(to) + '"' +
+            ' data-name="' + escapeHTML(name) + '"' +
+            (c.operation == 'R' ? ' data-oldname="' + escapeHTML(c.oldName) + '"' : '') +
+            ' title="' + escapeHTML(title) + '">' + escapeHTML(title) + '</a>';
+    });
+
+    return html + '</body></html>';
+}
+
+function formatSize(size) {
+    if (size < 1024) {
+        return size + ' B';
+    }
+    if (size < 1024 * 1024) {
+        return (size / 1024).toFixed(1) + ' KiB';
+    }
+    return (size / 1024 / 1024).toFixed(1) + ' MiB';
+}
+
+// showBinary shows sizes and hashes of a binary file instead of the diff editor
+function showBinary(detail) {
+    var b = detail.binary;
+    var originalFile = detail.oldFile || detail.file;
+
+    var html = '<p>' + (b.tooLarge ? 'File too large to display' : 'Binary file changed') + '</p><table>';
+    if (b.oldHash) {
+        html += '<tr><th>Old</th><td><a href="' + escapeHTML(contentURL(detail.tag1, originalFile)) + '">' +
+            escapeHTML(originalFile) + '</a></td><td>' + formatSize(b.oldSize) + '</td><td><code>' + b.oldHash + '</code></td></tr>';
+    }
+    if (b.hash) {
+        html += '<tr><th>New</th><td><a href="' + escapeHTML(contentURL(detail.tag2, detail.file)) + '">' +
+            escapeHTML(detail.file) + '</a></td><td>' + formatSize(b.size) + '</td><td><code>' + b.hash + '</code></td></tr>';
+    }
+    html += '</table>';
+
+    var diff = document.getElementById('diff');
+    diff.querySelector('.binary').innerHTML = html;
+    diff.classList.remove('loading');
+    diff.classList.add('binary');
 }
 
 function loadDiff(customEvent) {
+    if (customEvent.detail.binary) {
+        showBinary(customEvent.detail);
+        return;
+    }
+
+    document.getElementById('diff').classList.remove('binary');
     document.getElementById('diff').classList.add('loading');
 
+    var submodule = customEvent.detail.submodule;
+    if (submodule) {
+        // submodules have no content, compare their commits like git does
+        diffEditor.setModel({
+            original: monaco.editor.createModel(submodule.oldCommit ? "Subproject commit " + submodule.oldCommit + "\n" : "", 'plaintext'),
+            modified: monaco.editor.createModel(submodule.commit ? "Subproject commit " + submodule.commit + "\n" : "", 'plaintext')
+        });
+        document.getElementById('diff').classList.remove('loading');
+        return;
+    }
+
     originalFile = customEvent.detail.file;
     if (customEvent.detail.oldFile) {
         originalFile = customEvent.detail.oldFile;
     }
 
-    modifiedPath = "./content/" + customEvent.detail.tag2 + "/" + customEvent.detail.file;
-    originalPath = "./content/" + customEvent.detail.tag1 + "/" + originalFile;
+    modifiedPath = contentURL(customEvent.detail.tag2, customEvent.detail.file);
+    originalPath = contentURL(customEvent.detail.tag1, originalFile);
 
     Promise.all([xhr(originalPath), xhr(modifiedPath)]).then(function (r) {
         var originalTxt = r[0].responseText;
@@ -90,6 +312,7 @@ require(['vs/editor/editor.main'], function () {
     });
 });
 
+updatePairs();
 loadFiles();
 
 // listen to window resize events, update the editor layout accordingly
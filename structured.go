@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of structurally compared files, see file.Structure.
+const (
+	structureJSON = "json"
+	structureYAML = "yaml"
+	structureINI  = "ini"
+	structurePHP  = "php"
+)
+
+// errNotConfig is returned for PHP files not returning an array.
+var errNotConfig = errors.New("not a config file")
+
+// keyChange is an added, deleted or modified key of a structurally compared file.
+type keyChange struct {
+	Path      string `json:"path"`      // e.g. "db.host" or "servers[0].name"
+	Operation string `json:"operation"` // A, D or M
+	OldValue  string `json:"oldValue,omitempty"`
+	Value     string `json:"value,omitempty"`
+}
+
+// structureFormat returns the format to compare the file by keys in, empty if it is not a config file.
+func structureFormat(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		return structureJSON
+	case ".yaml", ".yml":
+		return structureYAML
+	case ".ini":
+		return structureINI
+	case ".php":
+		return structurePHP
+	}
+	return ""
+}
+
+// structuredDiff compares old and new contents of the text file patch by keys,
+// it returns the format and changed keys sorted by path, empty format if the file
+// can't be compared.
+func structuredDiff(patch diff.FilePatch) (string, []keyChange, error) {
+	from, to := patch.Files()
+	if from == nil || to == nil || !from.Mode().IsFile() || !to.Mode().IsFile() {
+		return "", nil, nil
+	}
+
+	format := structureFormat(to.Path())
+	if format == "" || format != structureFormat(from.Path()) {
+		return "", nil, nil
+	}
+
+	oldContent, newContent := patchContents(patch)
+
+	oldKeys, err := parseStructure(format, oldContent)
+	if err != nil {
+		return "", nil, fmt.Errorf("parse old %s: %w", from.Path(), err)
+	}
+	newKeys, err := parseStructure(format, newContent)
+	if err != nil {
+		return "", nil, fmt.Errorf("parse new %s: %w", to.Path(), err)
+	}
+
+	var changes []keyChange
+	for p, old := range oldKeys {
+		value, ok := newKeys[p]
+		switch {
+		case !ok:
+			changes = append(changes, keyChange{Path: p, Operation: "D", OldValue: old})
+		case value != old:
+			changes = append(changes, keyChange{Path: p, Operation: "M", OldValue: old, Value: value})
+		}
+	}
+	for p, value := range newKeys {
+		if _, ok := oldKeys[p]; !ok {
+			changes = append(changes, keyChange{Path: p, Operation: "A", Value: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	return format, changes, nil
+}
+
+// parseStructure parses the content and flattens it into a map of key paths to scalar values.
+func parseStructure(format, content string) (map[string]string, error) {
+	keys := map[string]string{}
+
+	switch format {
+	case structureJSON:
+		var v interface{}
+		d := json.NewDecoder(strings.NewReader(content))
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+		flatten("", v, keys)
+	case structureYAML:
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(content), &v); err != nil {
+			return nil, err
+		}
+		flatten("", v, keys)
+	case structureINI:
+		return parseINI(content)
+	case structurePHP:
+		v, err := parsePHPArray(content)
+		if err != nil {
+			return nil, err
+		}
+		flatten("", v, keys)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	return keys, nil
+}
+
+// flatten adds scalar values of v to keys, maps are joined with dots and lists with indexes,
+// e.g. "servers[0].name", empty maps and lists are values too.
+func flatten(prefix string, v interface{}, keys map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			keys[prefix] = "{}"
+		}
+		for key, value := range v {
+			flatten(join(key), value, keys)
+		}
+	case map[interface{}]interface{}:
+		if len(v) == 0 {
+			keys[prefix] = "{}"
+		}
+		for key, value := range v {
+			flatten(join(fmt.Sprint(key)), value, keys)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			keys[prefix] = "[]"
+		}
+		for i, value := range v {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), value, keys)
+		}
+	case nil:
+		keys[prefix] = "null"
+	default:
+		keys[prefix] = fmt.Sprint(v)
+	}
+}
+
+// parseINI parses keys of sections like "section.key", repeated "key[]" keys are numbered.
+func parseINI(content string) (map[string]string, error) {
+	keys := map[string]string{}
+	section := ""
+	counts := map[string]int{}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: no = in %q", n, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		if strings.HasSuffix(key, "[]") {
+			base := strings.TrimSuffix(key, "[]")
+			key = fmt.Sprintf("%s[%d]", base, counts[base])
+			counts[base]++
+		}
+
+		keys[key] = value
+	}
+
+	return keys, scanner.Err()
+}
+
+// phpParser reads the array returned by a PHP config file, like `<?php return ['db' => [...]];`.
+// Values other than arrays and string literals, e.g. function calls and constants,
+// are kept as source text.
+type phpParser struct {
+	src []rune
+	pos int
+}
+
+// parsePHPArray returns the array returned by the PHP file as a map, or a list
+// if it has no explicit keys, errNotConfig if the file doesn't return an array.
+func parsePHPArray(content string) (interface{}, error) {
+	content = strings.TrimSpace(strings.TrimPrefix(content, "\ufeff"))
+	if !strings.HasPrefix(content, "<?php") {
+		return nil, errNotConfig
+	}
+
+	p := &phpParser{src: []rune(strings.TrimPrefix(content, "<?php"))}
+	for p.skipSpace(); p.pos < len(p.src); p.skipSpace() {
+		if p.word() != "return" {
+			// other statements like declare() and use are skipped
+			p.expression()
+			p.pos++
+			continue
+		}
+
+		p.skipSpace()
+		if !p.isArrayStart() {
+			return nil, errNotConfig
+		}
+		return p.value()
+	}
+
+	return nil, errNotConfig
+}
+
+func (p *phpParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch {
+		case unicode.IsSpace(p.src[p.pos]):
+			p.pos++
+		case p.hasPrefix("//") || p.hasPrefix("#") && !p.hasPrefix("#["):
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case p.hasPrefix("/*"):
+			for p.pos += 2; p.pos < len(p.src) && !p.hasPrefix("*/"); p.pos++ {
+			}
+			p.pos = minInt(len(p.src), p.pos+2)
+		default:
+			return
+		}
+	}
+}
+
+func (p *phpParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.src[p.pos:minInt(len(p.src), p.pos+len(s))]), s)
+}
+
+// word reads an identifier, empty if there is none.
+func (p *phpParser) word() string {
+	start := p.pos
+	for p.pos < len(p.src) && (unicode.IsLetter(p.src[p.pos]) || unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '_' || p.src[p.pos] == '\\') {
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+func (p *phpParser) isArrayStart() bool {
+	if p.hasPrefix("[") {
+		return true
+	}
+
+	start := p.pos
+	defer func() { p.pos = start }()
+	if !strings.EqualFold(p.word(), "array") {
+		return false
+	}
+	p.skipSpace()
+	return p.hasPrefix("(")
+}
+
+// value reads an array, a string literal or an expression as its source text.
+func (p *phpParser) value() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, errors.New("unexpected end of file")
+	}
+
+	if p.isArrayStart() {
+		return p.array()
+	}
+
+	if r := p.src[p.pos]; r == '\'' || r == '"' {
+		start := p.pos
+		s, err := p.stringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		// concatenations and other expressions with strings are kept as is
+		p.skipSpace()
+		if p.pos < len(p.src) && !strings.ContainsRune(",])=;", p.src[p.pos]) {
+			p.pos = start
+			return p.expression(), nil
+		}
+		return s, nil
+	}
+
+	return p.expression(), nil
+}
+
+func (p *phpParser) array() (interface{}, error) {
+	end := ']'
+	if p.src[p.pos] != '[' {
+		p.word()
+		p.skipSpace()
+		end = ')'
+	}
+	p.pos++ // [ or (
+
+	var (
+		list  []interface{}
+		m     = map[string]interface{}{}
+		keyed bool
+		next  int // next integer key
+	)
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return nil, errors.New("unexpected end of file in array")
+		}
+		if p.src[p.pos] == end {
+			p.pos++
+			break
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		if p.hasPrefix("=>") {
+			p.pos += 2
+			key := fmt.Sprint(v)
+			if v, err = p.value(); err != nil {
+				return nil, err
+			}
+			keyed = true
+			m[key] = v
+			if n, err := strconv.Atoi(key); err == nil && n >= next {
+				next = n + 1
+			}
+		} else {
+			m[strconv.Itoa(next)] = v
+			next++
+		}
+		list = append(list, v)
+
+		p.skipSpace()
+		if p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+		} else if p.pos < len(p.src) && p.src[p.pos] != end {
+			return nil, fmt.Errorf("unexpected %q in array", p.src[p.pos])
+		}
+	}
+
+	if keyed {
+		return m, nil
+	}
+	if list == nil {
+		return []interface{}{}, nil
+	}
+	return list, nil
+}
+
+// stringLiteral reads a single or double quoted string, variables are not interpolated.
+func (p *phpParser) stringLiteral() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		p.pos++
+
+		switch {
+		case r == quote:
+			return sb.String(), nil
+		case r == '\\' && p.pos < len(p.src):
+			next := p.src[p.pos]
+			p.pos++
+			switch {
+			case next == quote || next == '\\':
+				sb.WriteRune(next)
+			case quote == '"' && next == 'n':
+				sb.WriteRune('\n')
+			case quote == '"' && next == 't':
+				sb.WriteRune('\t')
+			case quote == '"' && next == '$':
+				sb.WriteRune('$')
+			default:
+				sb.WriteRune('\\')
+				sb.WriteRune(next)
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	return "", errors.New("unterminated string")
+}
+
+// expression reads source text until a comma, a closing bracket, => or ; outside of brackets and strings.
+func (p *phpParser) expression() string {
+	start := p.pos
+	depth := 0
+
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		switch {
+		case r == '\'' || r == '"':
+			if _, err := p.stringLiteral(); err != nil {
+				return strings.TrimSpace(string(p.src[start:]))
+			}
+			continue
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			if depth == 0 {
+				return strings.TrimSpace(string(p.src[start:p.pos]))
+			}
+			depth--
+		case depth == 0 && (r == ',' || r == ';' || p.hasPrefix("=>")):
+			return strings.TrimSpace(string(p.src[start:p.pos]))
+		}
+		p.pos++
+	}
+
+	return strings.TrimSpace(string(p.src[start:]))
+}
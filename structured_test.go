@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+func TestParseStructure(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    map[string]string
+		err     error
+	}{
+		{
+			name:   "php short arrays",
+			format: structurePHP,
+			content: `<?php
+return [
+    'db' => ['host' => 'localhost', 'port' => 3306],
+    'hosts' => ['a', 'b'],
+    'empty' => [],
+];`,
+			want: map[string]string{
+				"db.host":  "localhost",
+				"db.port":  "3306",
+				"hosts[0]": "a",
+				"hosts[1]": "b",
+				"empty":    "[]",
+			},
+		},
+		{
+			name:   "php long arrays nested in short ones",
+			format: structurePHP,
+			content: `<?php
+return array(
+    'db' => array('host' => "db\tlocal"),
+    'list' => [array('a' => 1), ARRAY ()],
+);`,
+			want: map[string]string{
+				"db.host":   "db\tlocal",
+				"list[0].a": "1",
+				"list[1]":   "[]",
+			},
+		},
+		{
+			name:   "php mixed implicit and explicit keys",
+			format: structurePHP,
+			content: `<?php
+return ['a', 5 => 'b', 'c', 'key' => 'd', 'e'];`,
+			want: map[string]string{
+				"0":   "a",
+				"5":   "b",
+				"6":   "c",
+				"key": "d",
+				"7":   "e",
+			},
+		},
+		{
+			name:   "php comments",
+			format: structurePHP,
+			content: `<?php
+// line comment
+declare(strict_types=1); # another one
+/* block
+   comment */
+return [
+    'a' => 1, // after a value
+    # 'b' => 2,
+    /* 'c' => 3, */ 'd' => 4,
+];`,
+			want: map[string]string{
+				"a": "1",
+				"d": "4",
+			},
+		},
+		{
+			name:   "php concatenations and calls are kept as source",
+			format: structurePHP,
+			content: `<?php
+return [
+    'path' => __DIR__ . '/cache',
+    'name' => 'app' . '-' . env('SUFFIX', 'x'),
+    'debug' => env('DEBUG', false),
+];`,
+			want: map[string]string{
+				"path":  "__DIR__ . '/cache'",
+				"name":  "'app' . '-' . env('SUFFIX', 'x')",
+				"debug": "env('DEBUG', false)",
+			},
+		},
+		{
+			name:    "php not returning an array",
+			format:  structurePHP,
+			content: "<?php\nclass Config {}\n",
+			err:     errNotConfig,
+		},
+		{
+			name:    "php returning a call",
+			format:  structurePHP,
+			content: "<?php\nreturn config('app');\n",
+			err:     errNotConfig,
+		},
+		{
+			name:    "php template",
+			format:  structurePHP,
+			content: "<html><?php echo 1; ?></html>\n",
+			err:     errNotConfig,
+		},
+		{
+			name:   "ini sections and arrays",
+			format: structureINI,
+			content: `; comment
+name = "app"
+[db]
+host = localhost
+hosts[] = a
+hosts[] = 'b'
+# another comment
+[cache]
+hosts[] = c
+`,
+			want: map[string]string{
+				"name":           "app",
+				"db.host":        "localhost",
+				"db.hosts[0]":    "a",
+				"db.hosts[1]":    "b",
+				"cache.hosts[0]": "c",
+			},
+		},
+		{
+			name:    "json",
+			format:  structureJSON,
+			content: `{"servers": [{"name": "a", "port": 80}], "tags": {}, "big": 12345678901234567890, "none": null}`,
+			want: map[string]string{
+				"servers[0].name": "a",
+				"servers[0].port": "80",
+				"tags":            "{}",
+				"big":             "12345678901234567890",
+				"none":            "null",
+			},
+		},
+		{
+			name:   "yaml",
+			format: structureYAML,
+			content: `db:
+  host: localhost
+  replicas: [a, b]
+1: one
+`,
+			want: map[string]string{
+				"db.host":        "localhost",
+				"db.replicas[0]": "a",
+				"db.replicas[1]": "b",
+				"1":              "one",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStructure(tt.format, tt.content)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("parseStructure() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseStructure() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseStructure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseINIError(t *testing.T) {
+	if _, err := parseINI("[db]\nhost\n"); err == nil {
+		t.Error("parseINI() error = nil for a line without =")
+	}
+}
+
+func TestStructuredDiff(t *testing.T) {
+	from := entryFile{path: "config.php", mode: filemode.Regular}
+	to := entryFile{path: "config.php", mode: filemode.Regular}
+	patch := lineDiff(from, to,
+		"<?php\nreturn ['a' => 1, 'b' => 2, 'c' => [3]];\n",
+		"<?php\nreturn ['a' => 1, 'b' => 5, 'c' => [3, 4], 'd' => 6];\n", "")
+
+	format, changes, err := structuredDiff(patch)
+	if err != nil {
+		t.Fatalf("structuredDiff() error = %v", err)
+	}
+	if format != structurePHP {
+		t.Errorf("structuredDiff() format = %q, want %q", format, structurePHP)
+	}
+
+	want := []keyChange{
+		{Path: "b", Operation: "M", OldValue: "2", Value: "5"},
+		{Path: "c[1]", Operation: "A", Value: "4"},
+		{Path: "d", Operation: "A", Value: "6"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("structuredDiff() changes = %+v, want %+v", changes, want)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// changeTree is a directory of changed files with its subdirectories.
+type changeTree struct {
+	Name string // path relative to the parent, directories with a single subdirectory are joined, e.g. "src/app"
+	Path string // empty for the root
+
+	// A, D or R if the whole directory is added, deleted or renamed, empty otherwise
+	Operation string
+	OldPath   string // old path of the renamed directory
+
+	Count   opCount // numbers of changed files in the directory and subdirectories
+	Added   int     // number of added lines
+	Removed int     // number of removed lines
+
+	Dirs  []*changeTree
+	Files []file
+}
+
+// opCount is a number of changed files by operation.
+type opCount struct {
+	Total    int
+	New      int
+	Deleted  int
+	Modified int
+	Renamed  int
+	Copied   int
+}
+
+// treeRow is a row of the flattened change tree: a directory opening,
+// the opening of hidden files section, a file or the end of the last opened
+// directory or section.
+type treeRow struct {
+	Dir    *changeTree
+	Hidden bool
+	File   *file
+	End    bool
+}
+
+// newChangeTree groups changes by directories. Directories missing in the old tree
+// with only added files are reported as added, missing in the new tree with only
+// deleted files as deleted, and moved as a whole as renamed.
+func newChangeTree(changes []file, oldTree, newTree *object.Tree) *changeTree {
+	root := &changeTree{}
+
+	for _, f := range changes {
+		t := root
+		if dir := path.Dir(f.path()); dir != "." {
+			for _, name := range strings.Split(dir, "/") {
+				t = t.dir(name)
+			}
+		}
+		t.Files = append(t.Files, f)
+	}
+
+	root.count()
+	root.aggregate(oldTree, newTree)
+	root.compact()
+
+	return root
+}
+
+func (t *changeTree) dir(name string) *changeTree {
+	for _, d := range t.Dirs {
+		if d.Name == name {
+			return d
+		}
+	}
+
+	d := &changeTree{Name: name, Path: path.Join(t.Path, name)}
+	t.Dirs = append(t.Dirs, d)
+	return d
+}
+
+// count sorts the tree and sums up files and lines.
+func (t *changeTree) count() {
+	sort.Slice(t.Dirs, func(i, j int) bool { return t.Dirs[i].Name < t.Dirs[j].Name })
+	sort.SliceStable(t.Files, func(i, j int) bool { return t.Files[i].path() < t.Files[j].path() })
+
+	for _, d := range t.Dirs {
+		d.count()
+		t.Count.add(d.Count)
+		t.Added += d.Added
+		t.Removed += d.Removed
+	}
+
+	for _, f := range t.Files {
+		t.Count.Total++
+		switch f.Operation {
+		case "A":
+			t.Count.New++
+		case "D":
+			t.Count.Deleted++
+		case "R":
+			t.Count.Renamed++
+		case "C":
+			t.Count.Copied++
+		default:
+			t.Count.Modified++
+		}
+		t.Added += f.Added
+		t.Removed += f.Removed
+	}
+}
+
+func (c *opCount) add(other opCount) {
+	c.Total += other.Total
+	c.New += other.New
+	c.Deleted += other.Deleted
+	c.Modified += other.Modified
+	c.Renamed += other.Renamed
+	c.Copied += other.Copied
+}
+
+// aggregate sets Operation of directories added, deleted or renamed as a whole.
+func (t *changeTree) aggregate(oldTree, newTree *object.Tree) {
+	for _, d := range t.Dirs {
+		d.aggregate(oldTree, newTree)
+
+		switch d.Count.Total {
+		case d.Count.New:
+			if !hasDir(oldTree, d.Path) {
+				d.Operation = "A"
+			}
+		case d.Count.Deleted:
+			if !hasDir(newTree, d.Path) {
+				d.Operation = "D"
+			}
+		case d.Count.Renamed:
+			if oldPath := d.renamedFrom(); oldPath != "" && !hasDir(oldTree, d.Path) && !hasDir(newTree, oldPath) {
+				d.Operation = "R"
+				d.OldPath = oldPath
+			}
+		}
+	}
+}
+
+// renamedFrom returns the old path of the directory if all its files
+// are renamed from the same directory keeping their relative paths.
+func (t *changeTree) renamedFrom() string {
+	oldPath := ""
+	for _, f := range t.files() {
+		rel := strings.TrimPrefix(f.Name, t.Path+"/")
+		if !strings.HasSuffix(f.OldName, "/"+rel) {
+			return ""
+		}
+
+		p := strings.TrimSuffix(f.OldName, "/"+rel)
+		if oldPath != "" && p != oldPath {
+			return ""
+		}
+		oldPath = p
+	}
+	return oldPath
+}
+
+// files returns files of the directory and its subdirectories.
+func (t *changeTree) files() []file {
+	files := append([]file(nil), t.Files...)
+	for _, d := range t.Dirs {
+		files = append(files, d.files()...)
+	}
+	return files
+}
+
+func hasDir(tree *object.Tree, name string) bool {
+	if tree == nil {
+		return false
+	}
+	_, err := tree.Tree(name)
+	return err == nil
+}
+
+// compact joins directories having nothing but a single subdirectory with it.
+func (t *changeTree) compact() {
+	for i, d := range t.Dirs {
+		for len(d.Files) == 0 && len(d.Dirs) == 1 {
+			child := d.Dirs[0]
+			child.Name = d.Name + "/" + child.Name
+			d = child
+		}
+		d.compact()
+		t.Dirs[i] = d
+	}
+}
+
+// Rows returns the tree flattened in the order of rendering,
+// subdirectories go before files.
+func (t *changeTree) Rows() []treeRow {
+	var rows []treeRow
+	for _, d := range t.Dirs {
+		rows = append(rows, treeRow{Dir: d})
+		rows = append(rows, d.Rows()...)
+		rows = append(rows, treeRow{End: true})
+	}
+	for i := range t.Files {
+		rows = append(rows, treeRow{File: &t.Files[i]})
+	}
+	return rows
+}
+
+// fileRows returns rows of the tree followed by the section of hidden files.
+func fileRows(tree *changeTree, hidden []file) []treeRow {
+	rows := tree.Rows()
+	if len(hidden) == 0 {
+		return rows
+	}
+
+	rows = append(rows, treeRow{Hidden: true})
+	for i := range hidden {
+		rows = append(rows, treeRow{File: &hidden[i]})
+	}
+	return append(rows, treeRow{End: true})
+}
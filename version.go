@@ -0,0 +1,156 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// version is a tag name parsed for ordering.
+//
+// Supported formats:
+//   - SemVer 2.0: "1.2.3", "v1.2.3-rc.1", "1.2.3+build.5"
+//   - dotted numeric versions with any number of segments: "2.10", "2024.05.1"
+//   - Aegea build numbers: "2.10-v3877"
+//
+// A leading prefix made of letters and separators ("v", "release-") is ignored.
+type version struct {
+	valid      bool
+	release    []int    // numeric segments, e.g. [1 2 3]
+	prerelease []string // SemVer pre-release identifiers, e.g. ["rc", "1"]
+	build      int      // Aegea build number, e.g. 3877 in "2.10-v3877"
+}
+
+var (
+	aegeaVersionRe  = regexp.MustCompile(`^(\d+(?:\.\d+)*)-v(\d+)$`)
+	semverVersionRe = regexp.MustCompile(`^(\d+(?:\.\d+)*)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?$`)
+	versionPrefixRe = regexp.MustCompile(`^[A-Za-z_./-]*`)
+)
+
+func parseVersion(name string) version {
+	s := versionPrefixRe.ReplaceAllString(name, "")
+
+	if m := aegeaVersionRe.FindStringSubmatch(s); m != nil {
+		build, err := strconv.Atoi(m[2])
+		if err != nil {
+			return version{}
+		}
+		release, ok := parseRelease(m[1])
+		if !ok {
+			return version{}
+		}
+		return version{valid: true, release: release, build: build}
+	}
+
+	m := semverVersionRe.FindStringSubmatch(s)
+	if m == nil {
+		return version{}
+	}
+
+	release, ok := parseRelease(m[1])
+	if !ok {
+		return version{}
+	}
+
+	var prerelease []string
+	if m[2] != "" {
+		prerelease = strings.Split(m[2], ".")
+	}
+
+	return version{valid: true, release: release, prerelease: prerelease}
+}
+
+func parseRelease(s string) ([]int, bool) {
+	parts := strings.Split(s, ".")
+	release := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		release = append(release, n)
+	}
+	return release, true
+}
+
+// compareVersions returns -1 if a precedes b, 1 if b precedes a, and 0 if
+// they have equal precedence.
+//
+// Release segments are compared numerically, missing segments count as zero
+// ("1.2" == "1.2.0"). A version without pre-release identifiers has higher
+// precedence than the same version with them, identifiers are compared as
+// defined by SemVer 2.0. Build metadata is ignored. Aegea build numbers are
+// compared last.
+//
+// Valid versions always have higher precedence than invalid ones.
+func compareVersions(a, b version) int {
+	if a.valid != b.valid {
+		if a.valid {
+			return 1
+		}
+		return -1
+	}
+
+	for i := 0; i < len(a.release) || i < len(b.release); i++ {
+		var x, y int
+		if i < len(a.release) {
+			x = a.release[i]
+		}
+		if i < len(b.release) {
+			y = b.release[i]
+		}
+		if c := compareInts(x, y); c != 0 {
+			return c
+		}
+	}
+
+	if c := comparePrerelease(a.prerelease, b.prerelease); c != 0 {
+		return c
+	}
+
+	return compareInts(a.build, b.build)
+}
+
+func comparePrerelease(a, b []string) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, xErr := strconv.Atoi(a[i])
+		y, yErr := strconv.Atoi(b[i])
+
+		switch {
+		case xErr == nil && yErr == nil:
+			if c := compareInts(x, y); c != 0 {
+				return c
+			}
+		case xErr == nil:
+			// numeric identifiers have lower precedence
+			return -1
+		case yErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return compareInts(len(a), len(b))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		// SemVer 2.0 precedence example: alpha < alpha.1 < alpha.beta < beta < beta.2 < beta.11 < rc.1 < release
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-alpha.beta", "1.0.0-beta", -1},
+		{"1.0.0-beta", "1.0.0-beta.2", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0", "1.0.0-rc.1", 1},
+
+		// build metadata is ignored
+		{"1.0.0+build.5", "1.0.0", 0},
+		{"1.0.0+20130313144700", "1.0.0+exp.sha.5114f85", 0},
+		{"1.0.0-rc.1+build.1", "1.0.0-rc.1", 0},
+
+		// numeric segments, missing ones are zeros
+		{"1.10.0", "1.9.0", 1},
+		{"1.2", "1.2.0", 0},
+		{"2024.05.1", "2024.5", 1},
+
+		// prefixes are ignored
+		{"v1.2.3", "1.2.3", 0},
+		{"release-2.10", "v2.9", 1},
+		{"release/1.0.0-beta", "v1.0.0-alpha", 1},
+
+		// Aegea build numbers
+		{"2.10-v3877", "2.10-v3876", 1},
+		{"2.10-v3877", "2.10", 1},
+		{"2.9-v4000", "2.10-v3877", -1},
+
+		// invalid versions go below valid ones and are equal to each other
+		{"0.0.1", "latest", 1},
+		{"nightly", "latest", 0},
+		{"1.0.0-", "0.1", -1},
+		{"1.0.0..1", "0.1", -1},
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(parseVersion(tt.a), parseVersion(tt.b)); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// Whitespace modes, see diffOptions.Whitespace.
+const (
+	whitespaceAll    = "all"    // ignore all whitespace, like `git diff -w`
+	whitespaceAmount = "amount" // ignore changes in amount of whitespace, like `git diff -b`
+	whitespaceEOL    = "eol"    // ignore carriage returns at line ends, like `git diff --ignore-cr-at-eol`
+)
+
+// ignoreWhitespace recomputes the text file patch comparing lines normalized by mode.
+// Lines that are equal after normalization are kept as context from the new file.
+func ignoreWhitespace(patch diff.FilePatch, mode string) diff.FilePatch {
+	from, to := patch.Files()
+	oldContent, newContent := patchContents(patch)
+	return lineDiff(from, to, oldContent, newContent, mode)
+}
+
+// normalizeWhitespace returns the line without the line ending,
+// with whitespace removed or collapsed according to mode.
+func normalizeWhitespace(line, mode string) string {
+	line = strings.TrimSuffix(line, "\n")
+
+	switch mode {
+	case whitespaceAll:
+		return strings.Join(strings.Fields(line), "")
+	case whitespaceAmount:
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+
+		var sb strings.Builder
+		space := false
+		for _, r := range line {
+			if unicode.IsSpace(r) {
+				space = true
+				continue
+			}
+			if space {
+				sb.WriteByte(' ')
+				space = false
+			}
+			sb.WriteRune(r)
+		}
+		return sb.String()
+	case whitespaceEOL:
+		return strings.TrimSuffix(line, "\r")
+	}
+
+	return line
+}
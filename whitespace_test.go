@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestNormalizeWhitespace(t *testing.T) {
+	tests := []struct {
+		line string
+		mode string
+		want string
+	}{
+		{"\tfoo  bar \n", "", "\tfoo  bar "},
+		{"\tfoo  bar \n", whitespaceAll, "foobar"},
+		{"\tfoo \t bar \r\n", whitespaceAmount, " foo bar"},
+		// leading whitespace stays significant, like `git diff -b`
+		{"foo\n", whitespaceAmount, "foo"},
+		{"    foo\n", whitespaceAmount, " foo"},
+		{"foo\r\n", whitespaceEOL, "foo"},
+		{"foo\r\r\n", whitespaceEOL, "foo\r"},
+		{"fo\ro  \n", whitespaceEOL, "fo\ro  "},
+		{"foo", whitespaceEOL, "foo"},
+		{"привет мир\n", whitespaceAmount, "привет мир"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeWhitespace(tt.line, tt.mode); got != tt.want {
+			t.Errorf("normalizeWhitespace(%q, %q) = %q, want %q", tt.line, tt.mode, got, tt.want)
+		}
+	}
+}
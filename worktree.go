@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// Pseudo-ref names for local changes.
+const (
+	worktreeName = "WORKTREE"
+	indexName    = "INDEX"
+)
+
+// overlayStorer keeps objects created by the generator (trees and blobs
+// of pseudo-refs) in memory, and reads everything else from the repository.
+type overlayStorer struct {
+	storer.EncodedObjectStorer
+	mem *memory.Storage
+}
+
+func newOverlayStorer(base storer.EncodedObjectStorer) *overlayStorer {
+	return &overlayStorer{
+		EncodedObjectStorer: base,
+		mem:                 memory.NewStorage(),
+	}
+}
+
+func (s *overlayStorer) NewEncodedObject() plumbing.EncodedObject {
+	return s.mem.NewEncodedObject()
+}
+
+func (s *overlayStorer) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	return s.mem.SetEncodedObject(obj)
+}
+
+func (s *overlayStorer) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := s.mem.EncodedObject(t, h)
+	if err == plumbing.ErrObjectNotFound {
+		return s.EncodedObjectStorer.EncodedObject(t, h)
+	}
+	return obj, err
+}
+
+func (s *overlayStorer) HasEncodedObject(h plumbing.Hash) error {
+	if err := s.mem.HasEncodedObject(h); err == nil {
+		return nil
+	}
+	return s.EncodedObjectStorer.HasEncodedObject(h)
+}
+
+func (s *overlayStorer) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	size, err := s.mem.EncodedObjectSize(h)
+	if err == plumbing.ErrObjectNotFound {
+		return s.EncodedObjectStorer.EncodedObjectSize(h)
+	}
+	return size, err
+}
+
+// treeEntry is a file in a flat list of files a tree is built from.
+type treeEntry struct {
+	Mode filemode.FileMode
+	Hash plumbing.Hash
+}
+
+// getLocalRefs returns pseudo-refs for the staging index and the working tree.
+// Their trees are built from the index and Worktree.Status and stored in s.
+// Commit of both pseudo-refs is HEAD, it is used to find merge bases.
+func getLocalRefs(r *git.Repository, s storer.EncodedObjectStorer, withIndex, withWorktree bool) ([]ref, error) {
+	head, err := r.Head()
+	if err != nil {
+		return nil, fmt.Errorf("get HEAD: %w", err)
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("read index: %w", err)
+	}
+
+	files := map[string]treeEntry{}
+	for _, e := range idx.Entries {
+		// index.Merged is 1 in go-git, but merged entries have stage 0
+		if e.Stage != 0 {
+			log.Printf("Skipping unmerged %s (stage %d)", e.Name, e.Stage)
+			continue
+		}
+		files[e.Name] = treeEntry{Mode: e.Mode, Hash: e.Hash}
+	}
+
+	var refs []ref
+	now := time.Now()
+
+	if withIndex {
+		tree, err := buildTree(s, files)
+		if err != nil {
+			return nil, fmt.Errorf("build index tree: %w", err)
+		}
+
+		refs = append(refs, ref{
+			Name:    indexName,
+			Kind:    kindIndex,
+			Hash:    tree,
+			Commit:  head.Hash(),
+			Tree:    tree,
+			Date:    now,
+			Message: "Staged changes",
+		})
+	}
+
+	if withWorktree {
+		if err := applyWorktree(r, s, files); err != nil {
+			return nil, fmt.Errorf("read worktree: %w", err)
+		}
+
+		tree, err := buildTree(s, files)
+		if err != nil {
+			return nil, fmt.Errorf("build worktree tree: %w", err)
+		}
+
+		// the working tree goes first as the newest one
+		refs = append([]ref{{
+			Name:    worktreeName,
+			Kind:    kindWorktree,
+			Hash:    tree,
+			Commit:  head.Hash(),
+			Tree:    tree,
+			Date:    now,
+			Message: "Uncommitted changes",
+		}}, refs...)
+	}
+
+	return refs, nil
+}
+
+// applyWorktree updates files taken from the index with changes in the working tree,
+// untracked files that are not ignored are added too.
+func applyWorktree(r *git.Repository, s storer.EncodedObjectStorer, files map[string]treeEntry) error {
+	wt, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("get worktree: %w", err)
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return fmt.Errorf("get status: %w", err)
+	}
+
+	for name, st := range status {
+		switch st.Worktree {
+		case git.Unmodified:
+			continue
+		case git.Deleted:
+			delete(files, name)
+			continue
+		}
+
+		fi, err := wt.Filesystem.Lstat(name)
+		if os.IsNotExist(err) {
+			delete(files, name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", name, err)
+		}
+
+		mode, err := filemode.NewFromOSFileMode(fi.Mode())
+		if err != nil {
+			return fmt.Errorf("get mode of %s: %w", name, err)
+		}
+
+		hash, err := writeWorktreeBlob(s, wt, name, mode)
+		if err != nil {
+			return fmt.Errorf("write blob for %s: %w", name, err)
+		}
+
+		files[name] = treeEntry{Mode: mode, Hash: hash}
+	}
+
+	return nil
+}
+
+// writeWorktreeBlob stores the file content, or the link target for symlinks, as a blob.
+func writeWorktreeBlob(s storer.EncodedObjectStorer, wt *git.Worktree, name string, mode filemode.FileMode) (plumbing.Hash, error) {
+	if mode == filemode.Symlink {
+		target, err := wt.Filesystem.Readlink(name)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("read link: %w", err)
+		}
+		return writeBlob(s, strings.NewReader(target))
+	}
+
+	f, err := wt.Filesystem.Open(name)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	return writeBlob(s, f)
+}
+
+func writeBlob(s storer.EncodedObjectStorer, content io.Reader) (plumbing.Hash, error) {
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := io.Copy(w, content); err != nil {
+		w.Close()
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return s.SetEncodedObject(obj)
+}
+
+// buildTree writes tree objects for the flat list of files into s
+// and returns the hash of the root tree.
+func buildTree(s storer.EncodedObjectStorer, files map[string]treeEntry) (plumbing.Hash, error) {
+	var entries []object.TreeEntry
+	dirs := map[string]map[string]treeEntry{}
+
+	for name, e := range files {
+		dir, rest, ok := strings.Cut(name, "/")
+		if !ok {
+			entries = append(entries, object.TreeEntry{Name: name, Mode: e.Mode, Hash: e.Hash})
+			continue
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = map[string]treeEntry{}
+		}
+		dirs[dir][rest] = e
+	}
+
+	for dir, files := range dirs {
+		hash, err := buildTree(s, files)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("build %s: %w", dir, err)
+		}
+		entries = append(entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: hash})
+	}
+
+	// git sorts tree entries as if directory names had a trailing slash
+	sort.Slice(entries, func(i, j int) bool {
+		return treeEntrySortKey(entries[i]) < treeEntrySortKey(entries[j])
+	})
+
+	tree := object.Tree{Entries: entries}
+	obj := s.NewEncodedObject()
+	if err := tree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("encode tree: %w", err)
+	}
+
+	return s.SetEncodedObject(obj)
+}
+
+func treeEntrySortKey(e object.TreeEntry) string {
+	if e.Mode == filemode.Dir {
+		return e.Name + "/"
+	}
+	return e.Name
+}